@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"github.com/jm/hnk/internal/config"
+	"github.com/jm/hnk/internal/diff"
+	"github.com/jm/hnk/internal/git"
+	"github.com/jm/hnk/internal/grouper"
+	"github.com/urfave/cli/v3"
+)
+
+const maxSubjectLen = 72
+
+func commitCommand(cfg *config.Config) *cli.Command {
+	return &cli.Command{
+		Name:  "commit",
+		Usage: "Write a commit message for the staged changes and commit them",
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:  "no-edit",
+				Usage: "Commit with the generated message without opening an editor",
+			},
+		},
+		Action: interruptible(func(ctx context.Context, cmd *cli.Command) error {
+			return runCommit(ctx, cmd, cfg)
+		}),
+	}
+}
+
+func runCommit(ctx context.Context, cmd *cli.Command, cfg *config.Config) error {
+	repo := openRepository(cfg)
+	if !repo.IsRepo() {
+		return fmt.Errorf("not a git repository")
+	}
+
+	diffText, err := repo.GetDiff(ctx, true)
+	if err != nil {
+		return fmt.Errorf("failed to get diff: %w", err)
+	}
+	if diffText == "" {
+		return fmt.Errorf("no staged changes to commit")
+	}
+
+	parsed, err := diff.Parse(diffText)
+	if err != nil {
+		return fmt.Errorf("failed to parse diff: %w", err)
+	}
+
+	grp, err := newGrouper(cmd, cfg)
+	if err != nil {
+		return err
+	}
+	defer recordUsage(cmd, grp)
+	if err := setFunctionContext(ctx, cmd, cfg, repo, grp, sourceIndex); err != nil {
+		return err
+	}
+
+	groups, err := grp.GroupDiff(ctx, parsed)
+	if err != nil {
+		return fmt.Errorf("failed to group changes: %w", err)
+	}
+	if len(groups) == 0 {
+		return fmt.Errorf("no staged changes to commit")
+	}
+
+	gitDir, err := repo.GitDir(ctx)
+	if err != nil {
+		return err
+	}
+	msgPath := filepath.Join(gitDir, "HNK_COMMIT_EDITMSG")
+
+	message := commitMessage(groups)
+	if !cmd.Bool("no-edit") {
+		message += commitTemplateFooter(parsed)
+	}
+	if err := os.WriteFile(msgPath, []byte(message), 0644); err != nil {
+		return err
+	}
+
+	if !cmd.Bool("no-edit") {
+		if err := editFile(ctx, repo, msgPath); err != nil {
+			return err
+		}
+	}
+
+	return repo.CommitWithMessageFile(ctx, msgPath)
+}
+
+func commitMessage(groups []grouper.SemanticGroup) string {
+	primary := groups[0]
+
+	var sb strings.Builder
+	sb.WriteString(commitSubject(primary, groups))
+	sb.WriteString("\n\n")
+	writeBullets(&sb, groups, "")
+	return sb.String()
+}
+
+func writeBullets(sb *strings.Builder, groups []grouper.SemanticGroup, indent string) {
+	for _, g := range groups {
+		line := indent + "- " + g.Title
+		if g.Description != "" {
+			line += ": " + g.Description
+		}
+		sb.WriteString(line + "\n")
+		writeBullets(sb, g.Children, indent+"  ")
+	}
+}
+
+func commitSubject(primary grouper.SemanticGroup, groups []grouper.SemanticGroup) string {
+	prefix := commitType(primary)
+	if scope := commitScope(groups); scope != "" {
+		prefix += "(" + scope + ")"
+	}
+	subject := prefix + ": " + lowerFirst(strings.TrimSuffix(primary.Title, "."))
+	if runes := []rune(subject); len(runes) > maxSubjectLen {
+		subject = strings.TrimSpace(string(runes[:maxSubjectLen-3])) + "..."
+	}
+	return subject
+}
+
+func commitType(g grouper.SemanticGroup) string {
+	hunks := g.AllHunks()
+	allDocs, allTests := true, true
+	for _, gh := range hunks {
+		p := gh.File.NewPath
+		allDocs = allDocs && (strings.HasSuffix(p, ".md") || strings.HasPrefix(p, "docs/"))
+		allTests = allTests && isTestPath(p)
+	}
+	switch {
+	case len(hunks) > 0 && allDocs:
+		return "docs"
+	case len(hunks) > 0 && allTests:
+		return "test"
+	}
+
+	verb, _, _ := strings.Cut(g.Title, " ")
+	switch strings.ToLower(verb) {
+	case "fix", "resolve", "correct", "handle", "prevent", "guard":
+		return "fix"
+	case "add", "implement", "introduce", "support", "create", "allow", "enable":
+		return "feat"
+	case "refactor", "simplify", "extract", "rename", "move", "restructure", "clean", "split", "inline", "replace":
+		return "refactor"
+	case "document":
+		return "docs"
+	case "test":
+		return "test"
+	case "speed", "optimize":
+		return "perf"
+	default:
+		return "chore"
+	}
+}
+
+func isTestPath(p string) bool {
+	base := path.Base(p)
+	return strings.Contains(base, "_test.") || strings.Contains(base, ".test.") ||
+		strings.Contains(base, ".spec.") || strings.HasPrefix(base, "test_") ||
+		strings.HasPrefix(p, "test/") || strings.HasPrefix(p, "tests/")
+}
+
+func commitScope(groups []grouper.SemanticGroup) string {
+	var dir string
+	first := true
+	for _, g := range groups {
+		for _, gh := range g.AllHunks() {
+			d := path.Dir(gh.File.NewPath)
+			if first {
+				dir, first = d, false
+				continue
+			}
+			for dir != "." && d != dir && !strings.HasPrefix(d, dir+"/") {
+				dir = path.Dir(dir)
+			}
+		}
+	}
+	if dir == "." || dir == "/" || dir == "" {
+		return ""
+	}
+	return path.Base(dir)
+}
+
+func lowerFirst(s string) string {
+	runes := []rune(s)
+	if len(runes) < 2 || unicode.IsUpper(runes[1]) {
+		return s
+	}
+	runes[0] = unicode.ToLower(runes[0])
+	return string(runes)
+}
+
+func commitTemplateFooter(d *diff.Diff) string {
+	var sb strings.Builder
+	sb.WriteString("\n# Generated by hnk from the staged changes. Edit the message above.\n")
+	sb.WriteString("# Lines starting with '#' will be ignored, and an empty message aborts the commit.\n#\n")
+	sb.WriteString("# Changes to be committed:\n")
+	for _, f := range d.Files {
+		switch {
+		case f.IsNew:
+			sb.WriteString("#\tnew file:   " + f.NewPath + "\n")
+		case f.IsDeleted:
+			sb.WriteString("#\tdeleted:    " + f.OldPath + "\n")
+		case f.IsRenamed:
+			sb.WriteString("#\trenamed:    " + f.OldPath + " -> " + f.NewPath + "\n")
+		default:
+			sb.WriteString("#\tmodified:   " + f.NewPath + "\n")
+		}
+	}
+	return sb.String()
+}
+
+func editFile(ctx context.Context, repo *git.Repository, path string) error {
+	editor, err := repo.Editor(ctx)
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", editor+` "$@"`, editor, path)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("editor %q failed: %w", editor, err)
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/jm/hnk/internal/grouper"
+	"github.com/jm/hnk/internal/spinner"
+	"github.com/urfave/cli/v3"
+)
+
+var errInterrupted = errors.New("interrupted")
+
+// interruptible runs action with a context that is cancelled on Ctrl-C.
+// With --interrupt-fallback, a second Ctrl-C while the cancelled analysis is
+// still winding down shows heuristic grouping instead of waiting for it. Any
+// further Ctrl-C clears the spinner and exits immediately.
+func interruptible(action cli.ActionFunc) cli.ActionFunc {
+	return func(ctx context.Context, cmd *cli.Command) error {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		sigs := make(chan os.Signal, 1)
+		signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+		defer signal.Stop(sigs)
+
+		abandon := make(chan struct{})
+		fallback := cmd.Bool("interrupt-fallback")
+		done := make(chan struct{})
+		defer close(done)
+		go func() {
+			for n := 0; ; n++ {
+				select {
+				case <-sigs:
+				case <-done:
+					return
+				}
+				switch {
+				case n == 0:
+					cancel()
+				case n == 1 && fallback:
+					close(abandon)
+				default:
+					spinner.StopAll()
+					os.Exit(130)
+				}
+			}
+		}()
+
+		err := action(grouper.WithInterrupt(ctx, abandon), cmd)
+		select {
+		case <-abandon:
+			return err
+		default:
+		}
+		if ctx.Err() != nil {
+			return errInterrupted
+		}
+		return err
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/jm/hnk/internal/config"
+	"github.com/jm/hnk/internal/diff"
+	"github.com/jm/hnk/internal/git"
+	"github.com/jm/hnk/internal/grouper"
+	"github.com/jm/hnk/internal/pool"
+	"github.com/jm/hnk/internal/spinner"
+	"github.com/jm/hnk/internal/tui"
+	"github.com/urfave/cli/v3"
+)
+
+func logCommand(cfg *config.Config) *cli.Command {
+	return &cli.Command{
+		Name:      "log",
+		Usage:     "Analyze each commit in a range separately",
+		ArgsUsage: "<range> [-- paths...]",
+		Action: interruptible(func(ctx context.Context, cmd *cli.Command) error {
+			return runLog(ctx, cmd, cfg)
+		}),
+	}
+}
+
+func runLog(ctx context.Context, cmd *cli.Command, cfg *config.Config) error {
+	repo := openRepository(cfg)
+	if !repo.IsRepo() {
+		return fmt.Errorf("not a git repository")
+	}
+
+	args := cmd.Args().Slice()
+	if len(args) == 0 {
+		return fmt.Errorf("missing range, e.g. hnk log main..HEAD")
+	}
+	revRange, paths := args[0], args[1:]
+	// A single ref means the commits since it, not its whole history.
+	if !strings.Contains(revRange, "..") {
+		revRange += "..HEAD"
+	}
+
+	commits, err := repo.Commits(ctx, revRange, paths...)
+	if err != nil {
+		return fmt.Errorf("failed to list commits: %w", err)
+	}
+	if len(commits) == 0 {
+		fmt.Printf("No commits in %s\n", revRange)
+		return nil
+	}
+
+	grp, err := newGrouper(cmd, cfg)
+	if err != nil {
+		return err
+	}
+	defer recordUsage(cmd, grp)
+
+	if functionContext(cmd, cfg) {
+		grp.SetFunctionContext(commitSource(repo), cfg.ContextTokens)
+	}
+
+	analyze := func(ctx context.Context, c git.Commit) (grouper.Commit, error) {
+		diffText, err := repo.GetCommitDiff(ctx, c.SHA, paths...)
+		if err != nil {
+			return grouper.Commit{}, fmt.Errorf("failed to get diff of %s: %w", c.ShortSHA(), err)
+		}
+		parsed, err := diff.Parse(diffText)
+		if err != nil {
+			return grouper.Commit{}, fmt.Errorf("failed to parse diff of %s: %w", c.ShortSHA(), err)
+		}
+		groups, err := grp.GroupCommit(ctx, c.SHA, parsed)
+		if err != nil {
+			return grouper.Commit{}, fmt.Errorf("failed to group changes of %s: %w", c.ShortSHA(), err)
+		}
+		return grouper.Commit{Commit: c, Groups: groups}, nil
+	}
+
+	return showCommits(ctx, cmd, cfg, grp, len(commits), func(ctx context.Context, i int) (grouper.Commit, error) {
+		return analyze(ctx, commits[i])
+	})
+}
+
+// showCommits analyzes n commits, up to the configured concurrency at a
+// time, and shows each one with its groups as soon as it and the commits
+// before it are done, followed by a summary when there is more than one.
+func showCommits(ctx context.Context, cmd *cli.Command, cfg *config.Config, grp *grouper.Grouper, n int, analyze func(ctx context.Context, i int) (grouper.Commit, error)) error {
+	// The grouper's spinners would draw over each other.
+	grp.SetSpinnerOutput(io.Discard)
+
+	if cmd.Bool("tui") {
+		return tui.RunLog(ctx, tuiOptions(ctx, cmd, cfg, grp), func(ctx context.Context, emit func(grouper.Commit)) error {
+			_, err := analyzeCommits(ctx, cfg, n, analyze, func(i int, gc grouper.Commit) error {
+				emit(gc)
+				return nil
+			})
+			return err
+		})
+	}
+
+	r := newRenderer(cmd, cfg)
+	renderCommit := r.RenderCommit
+	if cmd.Bool("raw") {
+		renderCommit = r.RenderRawCommit
+	}
+
+	spin := spinner.New(os.Stderr, commitsMessage(0, n))
+	spin.Start()
+	analyzed, err := analyzeCommits(ctx, cfg, n, analyze, func(i int, gc grouper.Commit) error {
+		spin.Stop()
+		if err := renderCommit(i, gc); err != nil {
+			return err
+		}
+		if i+1 < n {
+			spin = spinner.New(os.Stderr, commitsMessage(i+1, n))
+			spin.Start()
+		}
+		return nil
+	})
+	spin.Stop()
+	if err != nil {
+		return err
+	}
+	if n > 1 {
+		r.RenderLogSummary(grouper.Summarize(analyzed))
+	}
+	return nil
+}
+
+func commitsMessage(done, n int) string {
+	return fmt.Sprintf("Analyzing commits (%d/%d)...", done, n)
+}
+
+// analyzeCommits runs analyze over n commits in parallel and passes each
+// result to show in order, as soon as the commits before it are shown.
+func analyzeCommits(ctx context.Context, cfg *config.Config, n int, analyze func(ctx context.Context, i int) (grouper.Commit, error), show func(i int, gc grouper.Commit) error) ([]grouper.Commit, error) {
+	indexes := make([]int, n)
+	for i := range indexes {
+		indexes[i] = i
+	}
+
+	var (
+		mu      sync.Mutex
+		pending = make(map[int]grouper.Commit)
+		next    int
+	)
+	return pool.Map(ctx, cfg.Concurrency, indexes, func(ctx context.Context, i int) (grouper.Commit, error) {
+		gc, err := analyze(ctx, i)
+		if err != nil {
+			return gc, err
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		pending[i] = gc
+		for {
+			ready, ok := pending[next]
+			if !ok {
+				return gc, nil
+			}
+			delete(pending, next)
+			if err := show(next, ready); err != nil {
+				return gc, err
+			}
+			next++
+		}
+	}, nil)
+}
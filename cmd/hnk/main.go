@@ -2,7 +2,9 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 
 	"github.com/jm/hnk/internal/ai"
@@ -22,13 +24,24 @@ func main() {
 	app := &cli.Command{
 		Name:      "hnk",
 		Usage:     "Semantic git diff viewer - groups related hunks with explanations",
-		ArgsUsage: "[commit] [-- paths...]",
+		ArgsUsage: "[commit | -] [-- paths...]",
 		Flags: []cli.Flag{
 			&cli.BoolFlag{
 				Name:    "staged",
 				Aliases: []string{"s"},
 				Usage:   "Show staged changes only",
 			},
+			&cli.BoolFlag{
+				Name:    "all",
+				Aliases: []string{"a"},
+				Usage:   "Show staged and unstaged changes together, marking which hunks are staged",
+			},
+			&cli.BoolFlag{
+				Name:    "untracked",
+				Aliases: []string{"u"},
+				Usage:   "Include untracked files in working tree diffs",
+				Value:   cfg.Untracked,
+			},
 			&cli.StringFlag{
 				Name:    "ref",
 				Aliases: []string{"r"},
@@ -42,12 +55,50 @@ func main() {
 				Name:  "to",
 				Usage: "End ref for range comparison (use with --from)",
 			},
+			&cli.StringFlag{
+				Name:  "patch",
+				Usage: "Read a diff, patch series or mbox from a file instead of git (- for stdin)",
+			},
+			&cli.IntFlag{
+				Name:  "parent",
+				Usage: "Diff a merge commit against its Nth parent instead of showing the combined diff",
+			},
 			&cli.StringFlag{
 				Name:    "model",
 				Aliases: []string{"m"},
-				Usage:   "Claude model to use (haiku, sonnet, opus)",
+				Usage:   "Model to use (haiku, sonnet, opus, or a provider-specific name)",
 				Value:   cfg.Model,
 			},
+			&cli.StringFlag{
+				Name:  "provider",
+				Usage: "AI backend to use (claude-cli, anthropic, openai)",
+				Value: cfg.Provider,
+			},
+			&cli.BoolFlag{
+				Name:  "offline",
+				Usage: "Group hunks with local heuristics instead of an AI model",
+			},
+			&cli.BoolFlag{
+				Name:  "no-split-hunks",
+				Usage: "Keep git hunks whole instead of splitting them into smaller units",
+			},
+			&cli.StringFlag{
+				Name:  "order",
+				Usage: "Group order: ai (reading order suggested by the model) or file (position in the diff)",
+				Value: grouper.OrderAI,
+			},
+			&cli.BoolFlag{
+				Name:  "function-context",
+				Usage: "Include the enclosing function or type of each hunk in the prompt",
+			},
+			&cli.BoolFlag{
+				Name:  "concerns-only",
+				Usage: "Only show groups the model has concerns about or low confidence in",
+			},
+			&cli.BoolFlag{
+				Name:  "no-stream",
+				Usage: "Wait for the complete analysis instead of showing groups as they arrive",
+			},
 			&cli.BoolFlag{
 				Name:  "no-color",
 				Usage: "Disable colored output",
@@ -73,25 +124,46 @@ func main() {
 				Name:  "style",
 				Usage: "Syntax highlighting style (monokai, dracula, github, etc.)",
 			},
+			&cli.BoolFlag{
+				Name:  "verbose",
+				Usage: "Print token usage and estimated cost after the analysis",
+			},
+			&cli.BoolFlag{
+				Name:  "interrupt-fallback",
+				Usage: "On a second Ctrl-C, show offline grouping instead of waiting for the cancelled model call",
+			},
 			&cli.BoolFlag{
 				Name:    "tui",
 				Aliases: []string{"i"},
 				Usage:   "Interactive TUI mode with keyboard navigation",
 			},
 		},
-		Action: func(ctx context.Context, cmd *cli.Command) error {
-			return run(ctx, cmd, cfg)
+		Commands: []*cli.Command{
+			commitCommand(cfg),
+			splitCommand(cfg),
+			logCommand(cfg),
+			usageCommand(),
 		},
+		Action: interruptible(func(ctx context.Context, cmd *cli.Command) error {
+			return run(ctx, cmd, cfg)
+		}),
 	}
 
 	if err := app.Run(context.Background(), os.Args); err != nil {
+		if errors.Is(err, errInterrupted) {
+			os.Exit(130)
+		}
 		fmt.Fprintf(os.Stderr, "error: %v\n", err)
 		os.Exit(1)
 	}
 }
 
 func run(ctx context.Context, cmd *cli.Command, cfg *config.Config) error {
-	repo := git.NewRepository("")
+	if path, ok := patchPath(cmd); ok {
+		return runPatch(ctx, cmd, cfg, path)
+	}
+
+	repo := openRepository(cfg)
 	if !repo.IsRepo() {
 		return fmt.Errorf("not a git repository")
 	}
@@ -115,25 +187,53 @@ func run(ctx context.Context, cmd *cli.Command, cfg *config.Config) error {
 	fromRef := cmd.String("from")
 	toRef := cmd.String("to")
 	ref := cmd.String("ref")
+	parent := cmd.Int("parent")
+	if cmd.IsSet("parent") && (commit == "" || parent < 1) {
+		return fmt.Errorf("--parent needs a commit and a parent number from 1")
+	}
 
+	source := sourceWorktree
+	worktree, stages := false, false
 	switch {
+	case commit != "" && parent > 0:
+		diffText, err = repo.GetDiffBetweenRefs(ctx, fmt.Sprintf("%s^%d", commit, parent), commit, paths...)
+		source = commit
 	case commit != "":
 		diffText, err = repo.GetCommitDiff(ctx, commit, paths...)
+		source = commit
 	case fromRef != "" && toRef != "":
 		diffText, err = repo.GetDiffBetweenRefs(ctx, fromRef, toRef, paths...)
+		source = toRef
 	case ref != "":
 		if !repo.IsValidRef(ctx, ref) {
 			return fmt.Errorf("invalid ref: %s", ref)
 		}
 		diffText, err = repo.GetDiffAgainstRef(ctx, ref, paths...)
+		worktree = true
+	case cmd.Bool("all"):
+		diffText, err = repo.GetDiffAgainstRef(ctx, "HEAD", paths...)
+		worktree, stages = true, true
+	case cmd.Bool("staged"):
+		diffText, err = repo.GetDiff(ctx, true, paths...)
+		source = sourceIndex
 	default:
-		diffText, err = repo.GetDiff(ctx, cmd.Bool("staged"), paths...)
+		diffText, err = repo.GetDiff(ctx, false, paths...)
+		worktree = true
 	}
 
 	if err != nil {
 		return fmt.Errorf("failed to get diff: %w", err)
 	}
 
+	var untracked string
+	if worktree && cmd.Bool("untracked") {
+		untracked, err = repo.GetUntrackedDiff(ctx, paths...)
+		if err != nil {
+			return fmt.Errorf("failed to diff untracked files: %w", err)
+		}
+		diffText += untracked
+	}
+
 	if diffText == "" {
 		fmt.Println("No changes to display")
 		return nil
@@ -149,50 +249,232 @@ func run(ctx context.Context, cmd *cli.Command, cfg *config.Config) error {
 		return nil
 	}
 
-	claudeAI := ai.NewClaudeCLI(cmd.String("model"))
-	c := cache.New(cfg.CacheSizeBytes())
-	grp := grouper.New(claudeAI, c)
+	if stages {
+		if err := tagStages(ctx, repo, parsed, untracked, paths); err != nil {
+			return err
+		}
+	}
+
+	grp, err := newGrouper(cmd, cfg)
+	if err != nil {
+		return err
+	}
+	defer recordUsage(cmd, grp)
+	if err := setFunctionContext(ctx, cmd, cfg, repo, grp, source); err != nil {
+		return err
+	}
+	return showDiff(ctx, cmd, cfg, grp, parsed)
+}
+
+func showDiff(ctx context.Context, cmd *cli.Command, cfg *config.Config, grp *grouper.Grouper, parsed *diff.Diff) error {
+	stream := !cmd.Bool("no-stream")
+
+	if cmd.Bool("tui") {
+		tuiOpts := tuiOptions(ctx, cmd, cfg, grp)
+		if !stream {
+			groups, err := grp.GroupDiff(ctx, parsed)
+			if err != nil {
+				return fmt.Errorf("failed to group changes: %w", err)
+			}
+			return tui.Run(groups, tuiOpts)
+		}
+
+		grp.SetSpinnerOutput(io.Discard)
+		return tui.RunStream(ctx, tuiOpts, func(ctx context.Context, emit func(grouper.SemanticGroup), reset func(), progress func(done, total int)) error {
+			grp.SetProgress(progress)
+			if _, err := grp.GroupDiffStream(ctx, parsed, emit, reset); err != nil {
+				return fmt.Errorf("failed to group changes: %w", err)
+			}
+			return nil
+		})
+	}
+
+	r := newRenderer(cmd, cfg)
 
-	groups, err := grp.GroupDiff(ctx, parsed)
+	if !stream {
+		groups, err := grp.GroupDiff(ctx, parsed)
+		if err != nil {
+			return fmt.Errorf("failed to group changes: %w", err)
+		}
+		if len(groups) == 0 {
+			fmt.Println(noGroupsMessage(cmd))
+			return nil
+		}
+		if cmd.Bool("raw") {
+			return r.RenderRaw(groups)
+		}
+		return r.RenderGroups(groups)
+	}
+
+	renderGroup := r.RenderGroup
+	if cmd.Bool("raw") {
+		renderGroup = r.RenderRawGroup
+	}
+
+	var renderErr error
+	rendered := 0
+	_, err := grp.GroupDiffStream(ctx, parsed, func(group grouper.SemanticGroup) {
+		if renderErr == nil {
+			renderErr = renderGroup(rendered, group)
+		}
+		rendered++
+	}, func() {
+		// Printed groups can't be taken back, so the final ones follow them.
+		fmt.Fprintln(os.Stderr, "The groups above were replaced; the final grouping follows.")
+		rendered = 0
+	})
 	if err != nil {
 		return fmt.Errorf("failed to group changes: %w", err)
 	}
+	if rendered == 0 {
+		fmt.Println(noGroupsMessage(cmd))
+	}
+	return renderErr
+}
 
-	lightMode := resolveTheme(cfg.Theme, cmd.Bool("light"), cmd.Bool("dark"))
+type displayOptions struct {
+	light    bool
+	lineNums bool
+	style    string
+}
 
-	lineNums := true
+func display(cmd *cli.Command, cfg *config.Config) displayOptions {
+	d := displayOptions{
+		light:    resolveTheme(cfg.Theme, cmd.Bool("light"), cmd.Bool("dark")),
+		lineNums: true,
+		style:    cfg.Style,
+	}
 	if cfg.LineNumbers != nil {
-		lineNums = *cfg.LineNumbers
+		d.lineNums = *cfg.LineNumbers
 	}
 	if cmd.Bool("no-line-numbers") {
-		lineNums = false
+		d.lineNums = false
 	}
-
-	style := cfg.Style
 	if cmd.String("style") != "" {
-		style = cmd.String("style")
+		d.style = cmd.String("style")
 	}
+	return d
+}
 
-	r := render.New(
+func newRenderer(cmd *cli.Command, cfg *config.Config) *render.Renderer {
+	d := display(cmd, cfg)
+	return render.New(
 		os.Stdout,
-		render.WithColor(!cmd.Bool("no-color")),
-		render.WithLight(lightMode),
-		render.WithLineNumbers(lineNums),
-		render.WithStyle(style),
+		render.WithColor(!cmd.Bool("no-color") && !cmd.Bool("raw")),
+		render.WithLight(d.light),
+		render.WithLineNumbers(d.lineNums),
+		render.WithStyle(d.style),
 	)
+}
 
-	if cmd.Bool("tui") {
-		return tui.Run(groups, tui.Options{
-			LightMode:   lightMode,
-			LineNumbers: lineNums,
-			StyleName:   style,
-		})
+func tuiOptions(ctx context.Context, cmd *cli.Command, cfg *config.Config, grp *grouper.Grouper) tui.Options {
+	d := display(cmd, cfg)
+	opts := tui.Options{
+		LightMode:   d.light,
+		LineNumbers: d.lineNums,
+		StyleName:   d.style,
+		InputTTY:    readsStdin(cmd),
+	}
+	if !cmd.Bool("offline") {
+		opts.Ask = func(group grouper.SemanticGroup, history []ai.Exchange, question string) (string, error) {
+			return grp.Ask(ctx, group, history, question)
+		}
 	}
+	return opts
+}
 
-	if cmd.Bool("raw") {
-		return r.RenderRaw(groups)
+func noGroupsMessage(cmd *cli.Command) string {
+	if cmd.Bool("concerns-only") {
+		return "No groups need attention"
+	}
+	return "No changes to display"
+}
+
+func newGrouper(cmd *cli.Command, cfg *config.Config) (*grouper.Grouper, error) {
+	var analyzer ai.Analyzer
+	if !cmd.Bool("offline") {
+		var err error
+		analyzer, err = ai.NewAnalyzer(analyzerOptions(cmd, cfg))
+		if err != nil {
+			return nil, err
+		}
+	}
+	c := cache.New(cfg.CacheSizeBytes())
+	grp := grouper.New(analyzer, c)
+
+	splitHunks := true
+	if cfg.SplitHunks != nil {
+		splitHunks = *cfg.SplitHunks
+	}
+	if cmd.Bool("no-split-hunks") {
+		splitHunks = false
+	}
+	grp.SetSplitHunks(splitHunks)
+	grp.SetConcernsOnly(cmd.Bool("concerns-only"))
+	if err := grp.SetOrder(cmd.String("order")); err != nil {
+		return nil, err
+	}
+
+	return grp, nil
+}
+
+// tagStages marks the hunks of a HEAD to working tree diff as staged or
+// unstaged by comparing it with the two halves of the change.
+func tagStages(ctx context.Context, repo *git.Repository, combined *diff.Diff, untracked string, paths []string) error {
+	stagedText, err := repo.GetDiff(ctx, true, paths...)
+	if err != nil {
+		return fmt.Errorf("failed to get staged diff: %w", err)
+	}
+	unstagedText, err := repo.GetDiff(ctx, false, paths...)
+	if err != nil {
+		return fmt.Errorf("failed to get unstaged diff: %w", err)
+	}
+
+	staged, err := diff.Parse(stagedText)
+	if err != nil {
+		return fmt.Errorf("failed to parse staged diff: %w", err)
+	}
+	unstaged, err := diff.Parse(unstagedText + untracked)
+	if err != nil {
+		return fmt.Errorf("failed to parse unstaged diff: %w", err)
+	}
+	diff.TagStages(combined, staged, unstaged)
+	return nil
+}
+
+func openRepository(cfg *config.Config) *git.Repository {
+	repo := git.NewRepository("")
+	repo.Timeout = cfg.GitTimeout()
+	return repo
+}
+
+func analyzerOptions(cmd *cli.Command, cfg *config.Config) ai.Options {
+	opts := ai.Options{
+		Provider:        cmd.String("provider"),
+		Model:           cmd.String("model"),
+		MaxPromptTokens: cfg.MaxPromptTokens,
+		MaxRetries:      cfg.ValidationRetries,
+		Concurrency:     cfg.Concurrency,
+		Timeout:         cfg.Timeout(),
+		Retries:         cfg.Retries,
+		FallbackModels:  cfg.FallbackModels,
+	}
+	switch opts.Provider {
+	case ai.ProviderAnthropic:
+		opts.APIKey = cfg.Anthropic.APIKey
+		opts.BaseURL = cfg.Anthropic.BaseURL
+	case ai.ProviderOpenAI:
+		opts.APIKey = cfg.OpenAI.APIKey
+		opts.BaseURL = cfg.OpenAI.BaseURL
+		opts.JSONMode = cfg.OpenAI.JSONMode
+		// The default model and fallbacks name Claude models, so they only
+		// apply when --model asks for a model explicitly.
+		if !cmd.IsSet("model") {
+			opts.Model = cfg.OpenAI.Model
+			opts.FallbackModels = nil
+		}
 	}
-	return r.RenderGroups(groups)
+	return opts
 }
 
 func resolveTheme(cfgTheme string, forceLight, forceDark bool) bool {
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/jm/hnk/internal/config"
+	"github.com/jm/hnk/internal/diff"
+	"github.com/jm/hnk/internal/git"
+	"github.com/jm/hnk/internal/grouper"
+	"github.com/jm/hnk/internal/patch"
+	"github.com/urfave/cli/v3"
+)
+
+const stdinPatch = "-"
+
+// patchPath returns where to read a diff from instead of running git:
+// --patch, "-" for stdin, or stdin when a diff is piped in and nothing else
+// was asked for.
+func patchPath(cmd *cli.Command) (string, bool) {
+	if path := cmd.String("patch"); path != "" {
+		return path, true
+	}
+	if cmd.Args().First() == stdinPatch || pipedDiff(cmd) {
+		return stdinPatch, true
+	}
+	return "", false
+}
+
+// pipedDiff reports whether stdin is a pipe or file while hnk has no
+// arguments and no flag that picks a diff from git. That is how git runs
+// its pager, so core.pager can be plain hnk.
+func pipedDiff(cmd *cli.Command) bool {
+	if cmd.Args().Present() {
+		return false
+	}
+	for _, name := range []string{"staged", "all", "untracked", "ref", "from", "to", "parent"} {
+		if cmd.IsSet(name) {
+			return false
+		}
+	}
+	info, err := os.Stdin.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice == 0
+}
+
+func readsStdin(cmd *cli.Command) bool {
+	path, ok := patchPath(cmd)
+	return ok && path == stdinPatch
+}
+
+func readPatch(path string) (string, error) {
+	if path == stdinPatch {
+		data, err := io.ReadAll(os.Stdin)
+		return string(data), err
+	}
+	data, err := os.ReadFile(path)
+	return string(data), err
+}
+
+func runPatch(ctx context.Context, cmd *cli.Command, cfg *config.Config, path string) error {
+	input, err := readPatch(path)
+	if err != nil {
+		return fmt.Errorf("failed to read patch: %w", err)
+	}
+
+	var patches []patch.Patch
+	var parsed []*diff.Diff
+	for _, p := range patch.Split(patch.Clean(input)) {
+		d, err := diff.Parse(p.Diff)
+		if err != nil {
+			return fmt.Errorf("failed to parse diff: %w", err)
+		}
+		if len(d.Files) > 0 {
+			patches = append(patches, p)
+			parsed = append(parsed, d)
+		}
+	}
+	if len(patches) == 0 {
+		// Not a diff, like git log without -p when hnk is the pager.
+		_, err := io.WriteString(os.Stdout, input)
+		return err
+	}
+
+	grp, err := newGrouper(cmd, cfg)
+	if err != nil {
+		return err
+	}
+	defer recordUsage(cmd, grp)
+
+	if len(patches) == 1 && patches[0].Commit == (git.Commit{}) {
+		return showDiff(ctx, cmd, cfg, grp, parsed[0])
+	}
+	return showCommits(ctx, cmd, cfg, grp, len(patches), func(ctx context.Context, i int) (grouper.Commit, error) {
+		groups, err := grp.GroupCommit(ctx, patches[i].SHA, parsed[i])
+		if err != nil {
+			return grouper.Commit{}, fmt.Errorf("failed to group changes: %w", err)
+		}
+		return grouper.Commit{Commit: patches[i].Commit, Groups: groups}, nil
+	})
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+const pipedPatch = `diff --git a/greet.go b/greet.go
+--- a/greet.go
++++ b/greet.go
+@@ -1,3 +1,3 @@
+ package greet
+ 
+-const Hello = "hello"
++const Hello = "hello, world"
+`
+
+var ansi = regexp.MustCompile("\x1b\\[[0-9;]*m")
+
+// TestPipedDiff runs hnk the way git runs its pager: no arguments and the
+// output of git on stdin.
+func TestPipedDiff(t *testing.T) {
+	repo := gitRepo(t, map[string]string{"main.go": "package main\n"}, map[string]string{"main.go": "package main\n\nfunc main() {}\n"})
+
+	tests := []struct {
+		name  string
+		dir   string
+		input string
+		args  []string
+		want  []string
+		skip  []string
+	}{
+		{
+			name:  "diff outside a repository",
+			dir:   t.TempDir(),
+			input: pipedPatch,
+			want:  []string{"Modify greet.go", `+const Hello = "hello, world"`},
+		},
+		{
+			name:  "diff inside a repository",
+			dir:   repo,
+			input: pipedPatch,
+			want:  []string{"Modify greet.go"},
+			skip:  []string{"main.go"},
+		},
+		{
+			name:  "no diff",
+			dir:   repo,
+			input: "0123abc Fix it\n",
+			want:  []string{"0123abc Fix it\n"},
+		},
+		{
+			name:  "a flag picks the diff from git",
+			dir:   repo,
+			input: pipedPatch,
+			args:  []string{"--all"},
+			want:  []string{"main.go", "+func main() {}"},
+			skip:  []string{"greet.go"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := ansi.ReplaceAllString(hnkInput(t, tt.dir, "patch", strings.NewReader(tt.input), tt.args...), "")
+			for _, want := range tt.want {
+				if !strings.Contains(out, want) {
+					t.Errorf("output does not contain %q:\n%s", want, out)
+				}
+			}
+			for _, skip := range tt.skip {
+				if strings.Contains(out, skip) {
+					t.Errorf("output contains %q:\n%s", skip, out)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/jm/hnk/internal/config"
+	"github.com/jm/hnk/internal/git"
+	"github.com/jm/hnk/internal/grouper"
+	"github.com/urfave/cli/v3"
+)
+
+// Where the new side of a diff is read from for --function-context: the
+// working tree, the index, or any other value as a revision.
+const (
+	sourceWorktree = ""
+	sourceIndex    = ":"
+)
+
+func functionContext(cmd *cli.Command, cfg *config.Config) bool {
+	return cmd.Bool("function-context") || cfg.FunctionContext
+}
+
+func setFunctionContext(ctx context.Context, cmd *cli.Command, cfg *config.Config, repo *git.Repository, grp *grouper.Grouper, rev string) error {
+	if !functionContext(cmd, cfg) {
+		return nil
+	}
+	source, err := fileSource(ctx, repo, rev)
+	if err != nil {
+		return err
+	}
+	grp.SetFunctionContext(source, cfg.ContextTokens)
+	return nil
+}
+
+func fileSource(ctx context.Context, repo *git.Repository, rev string) (grouper.SourceFunc, error) {
+	switch rev {
+	case sourceWorktree:
+		top, err := repo.TopLevel(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return func(ctx context.Context, _, path string) ([]byte, error) {
+			return os.ReadFile(filepath.Join(top, path))
+		}, nil
+	case sourceIndex:
+		rev = ""
+	}
+	return func(ctx context.Context, _, path string) ([]byte, error) {
+		out, err := repo.ShowFile(ctx, rev, path)
+		return []byte(out), err
+	}, nil
+}
+
+// commitSource reads each file at the commit being grouped, for the
+// commits of a log.
+func commitSource(repo *git.Repository) grouper.SourceFunc {
+	return func(ctx context.Context, commit, path string) ([]byte, error) {
+		out, err := repo.ShowFile(ctx, commit, path)
+		return []byte(out), err
+	}
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jm/hnk/internal/config"
+	"github.com/jm/hnk/internal/diff"
+	"github.com/jm/hnk/internal/git"
+	"github.com/jm/hnk/internal/grouper"
+	"github.com/urfave/cli/v3"
+)
+
+type splitCommit struct {
+	title       string
+	description string
+	parent      string
+	files       []string
+	patch       string
+}
+
+type splitLeaf struct {
+	group  grouper.SemanticGroup
+	parent string
+}
+
+func splitCommand(cfg *config.Config) *cli.Command {
+	return &cli.Command{
+		Name:      "split",
+		Usage:     "Commit unstaged changes as one commit per semantic group",
+		ArgsUsage: "[paths...]",
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:  "dry-run",
+				Usage: "Print the commits that would be made without touching the index",
+			},
+		},
+		Action: interruptible(func(ctx context.Context, cmd *cli.Command) error {
+			return runSplit(ctx, cmd, cfg)
+		}),
+	}
+}
+
+func runSplit(ctx context.Context, cmd *cli.Command, cfg *config.Config) error {
+	repo := openRepository(cfg)
+	if !repo.IsRepo() {
+		return fmt.Errorf("not a git repository")
+	}
+
+	staged, err := repo.HasStagedChanges(ctx)
+	if err != nil {
+		return err
+	}
+	if staged {
+		return fmt.Errorf("the index already has staged changes; commit or unstage them before running hnk split")
+	}
+
+	diffText, err := repo.GetDiff(ctx, false, cmd.Args().Slice()...)
+	if err != nil {
+		return fmt.Errorf("failed to get diff: %w", err)
+	}
+	if cmd.Bool("untracked") {
+		untracked, err := repo.GetUntrackedDiff(ctx, cmd.Args().Slice()...)
+		if err != nil {
+			return fmt.Errorf("failed to diff untracked files: %w", err)
+		}
+		diffText += untracked
+	}
+	if diffText == "" {
+		fmt.Println("No changes to split")
+		return nil
+	}
+
+	parsed, err := diff.Parse(diffText)
+	if err != nil {
+		return fmt.Errorf("failed to parse diff: %w", err)
+	}
+
+	grp, err := newGrouper(cmd, cfg)
+	if err != nil {
+		return err
+	}
+	defer recordUsage(cmd, grp)
+	if err := setFunctionContext(ctx, cmd, cfg, repo, grp, sourceWorktree); err != nil {
+		return err
+	}
+
+	groups, err := grp.GroupDiff(ctx, parsed)
+	if err != nil {
+		return fmt.Errorf("failed to group changes: %w", err)
+	}
+
+	if err := grp.Report().Err; err != nil && !cmd.Bool("dry-run") {
+		return fmt.Errorf("not splitting along heuristic groups after the AI analysis failed (use --offline to split along them anyway): %w", err)
+	}
+
+	plan, skipped := buildSplitPlan(parsed, groups)
+	if len(plan) == 0 {
+		fmt.Println("No changes to split")
+		return nil
+	}
+
+	if cmd.Bool("dry-run") {
+		printSplitPlan(plan, skipped)
+		return nil
+	}
+
+	for i, c := range plan {
+		if err := commitSplit(ctx, repo, c); err != nil {
+			return fmt.Errorf("group %d (%s): %w", i+1, c.title, err)
+		}
+	}
+
+	for _, path := range skipped {
+		fmt.Printf("left unstaged: %s (no textual hunks)\n", path)
+	}
+	return nil
+}
+
+// commitSplit stages and commits one group. If either step fails, the
+// index is put back the way it was, so no part of the group stays staged.
+func commitSplit(ctx context.Context, repo *git.Repository, c splitCommit) error {
+	tree, err := repo.WriteTree(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to save the index: %w", err)
+	}
+
+	err = repo.ApplyToIndex(ctx, c.patch)
+	if err != nil {
+		err = fmt.Errorf("failed to stage: %w", err)
+	} else if err = repo.Commit(ctx, c.message()); err != nil {
+		err = fmt.Errorf("failed to commit: %w", err)
+	}
+	if err != nil {
+		if rerr := repo.ReadTree(context.WithoutCancel(ctx), tree); rerr != nil {
+			return fmt.Errorf("%w (restoring the index also failed: %v)", err, rerr)
+		}
+	}
+	return err
+}
+
+func (c *splitCommit) message() string {
+	var body []string
+	if c.description != "" {
+		body = append(body, c.description)
+	}
+	if c.parent != "" {
+		body = append(body, "Part of: "+c.parent)
+	}
+	if len(body) == 0 {
+		return c.title + "\n"
+	}
+	return c.title + "\n\n" + strings.Join(body, "\n\n") + "\n"
+}
+
+func buildSplitPlan(d *diff.Diff, groups []grouper.SemanticGroup) ([]splitCommit, []string) {
+	wholeFileDone := make(map[string]bool)
+
+	var leaves []splitLeaf
+	for _, g := range groups {
+		for _, leaf := range g.Leaves() {
+			parent := ""
+			if len(g.Children) > 0 {
+				parent = g.Title
+			}
+			leaves = append(leaves, splitLeaf{group: leaf, parent: parent})
+		}
+	}
+
+	var plan []splitCommit
+	for _, l := range leaves {
+		g := l.group
+		var files []*diff.FileDiff
+		hunks := make(map[*diff.FileDiff][]*diff.Hunk)
+		for _, gh := range g.Stitched() {
+			if _, ok := hunks[gh.File]; !ok {
+				files = append(files, gh.File)
+			}
+			hunks[gh.File] = append(hunks[gh.File], gh.Hunk)
+		}
+
+		c := splitCommit{title: g.Title, description: g.Description, parent: l.parent}
+		var patch strings.Builder
+		for _, f := range files {
+			fileHunks := hunks[f]
+			if f.IsNew || f.IsDeleted {
+				key := f.OldPath + "\x00" + f.NewPath
+				if wholeFileDone[key] {
+					continue
+				}
+				wholeFileDone[key] = true
+				fileHunks = nil
+				for i := range f.Hunks {
+					fileHunks = append(fileHunks, &f.Hunks[i])
+				}
+			}
+			patch.WriteString(diff.FormatPatch(f, fileHunks))
+			c.files = append(c.files, splitFileLabel(f, fileHunks))
+		}
+
+		if patch.Len() == 0 {
+			continue
+		}
+		c.patch = patch.String()
+		plan = append(plan, c)
+	}
+
+	var skipped []string
+	for _, f := range d.Files {
+		if len(f.Hunks) == 0 {
+			skipped = append(skipped, f.NewPath)
+		}
+	}
+	return plan, skipped
+}
+
+func splitFileLabel(f *diff.FileDiff, hunks []*diff.Hunk) string {
+	switch {
+	case f.IsNew:
+		return f.NewPath + " (new)"
+	case f.IsDeleted:
+		return f.OldPath + " (deleted)"
+	}
+	adds, removes := 0, 0
+	for _, h := range hunks {
+		a, r := h.Stats()
+		adds += a
+		removes += r
+	}
+	return fmt.Sprintf("%s (+%d/-%d)", f.NewPath, adds, removes)
+}
+
+func printSplitPlan(plan []splitCommit, skipped []string) {
+	for i, c := range plan {
+		indent := ""
+		if c.parent != "" {
+			indent = "  "
+			if i == 0 || plan[i-1].parent != c.parent {
+				fmt.Printf("%s\n", c.parent)
+			}
+		}
+		fmt.Printf("%s%d. %s\n", indent, i+1, c.title)
+		if c.description != "" {
+			fmt.Printf("%s   %s\n", indent, c.description)
+		}
+		for _, f := range c.files {
+			fmt.Printf("%s     %s\n", indent, f)
+		}
+		fmt.Println()
+	}
+	for _, path := range skipped {
+		fmt.Printf("would leave unstaged: %s (no textual hunks)\n", path)
+	}
+}
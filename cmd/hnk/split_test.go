@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jm/hnk/internal/git"
+)
+
+// TestMain lets the tests run hnk as a command: the test binary starts
+// itself again with HNK_TEST_MAIN set, and then acts as hnk.
+func TestMain(m *testing.M) {
+	if os.Getenv("HNK_TEST_MAIN") != "" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// gitEnv keeps the user's git config out of the tests and gives them an
+// identity to commit with.
+var gitEnv = []string{
+	"GIT_CONFIG_GLOBAL=/dev/null", "GIT_CONFIG_NOSYSTEM=1",
+	"GIT_AUTHOR_NAME=t", "GIT_AUTHOR_EMAIL=t@t", "GIT_COMMITTER_NAME=t", "GIT_COMMITTER_EMAIL=t@t",
+}
+
+// hnk runs hnk in dir with the model's answers replayed from
+// testdata/<fixtures>, and returns its standard output.
+func hnk(t *testing.T, dir, fixtures string, args ...string) string {
+	t.Helper()
+	return hnkInput(t, dir, fixtures, nil, args...)
+}
+
+// hnkInput is hnk with stdin read from stdin, or from /dev/null if it is nil.
+func hnkInput(t *testing.T, dir, fixtures string, stdin io.Reader, args ...string) string {
+	t.Helper()
+	replay, err := filepath.Abs(filepath.Join("testdata", fixtures))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Dir = dir
+	cmd.Stdin = stdin
+	cmd.Env = append(append(os.Environ(), gitEnv...), "HNK_TEST_MAIN=1", "HOME="+t.TempDir(), "HNK_AI=replay:"+replay)
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("hnk %s: %v\n%s", strings.Join(args, " "), err, stderr.String())
+	}
+	return string(out)
+}
+
+// gitRepo creates a repository whose HEAD has files, and then writes
+// changes to the working tree.
+func gitRepo(t *testing.T, files, changes map[string]string) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := t.TempDir()
+	write := func(files map[string]string) {
+		for path, content := range files {
+			if err := os.WriteFile(filepath.Join(dir, path), []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	runGit(t, dir, "init", "-q")
+	write(files)
+	runGit(t, dir, "add", ".")
+	runGit(t, dir, "commit", "-q", "-m", "init")
+	write(changes)
+	return dir
+}
+
+// runGit runs git in dir and returns its output.
+func runGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), gitEnv...)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+	return string(out)
+}
+
+// splitRepo has two changes in a.go and one in b.go, which the fixtures in
+// testdata/split group into "Greet the world" and "Count every item".
+func splitRepo(t *testing.T) string {
+	return gitRepo(t, map[string]string{
+		"a.go": "package demo\n\nfunc Greet() string {\n\treturn \"hello\"\n}\n\nfunc Count(items []string) int {\n\treturn len(items) - 1\n}\n",
+		"b.go": "package demo\n\nconst Name = \"demo\"\n",
+	}, map[string]string{
+		"a.go": "package demo\n\nfunc Greet() string {\n\treturn \"hello, world\"\n}\n\nfunc Count(items []string) int {\n\treturn len(items)\n}\n",
+		"b.go": "package demo\n\nconst Name = \"hnk demo\"\n",
+	})
+}
+
+func TestSplitDryRun(t *testing.T) {
+	dir := splitRepo(t)
+
+	got := hnk(t, dir, "split", "split", "--dry-run")
+	want := `1. Greet the world
+   Change the greeting and the name.
+     a.go (+1/-1)
+     b.go (+1/-1)
+
+2. Count every item
+   Fix an off-by-one in Count.
+     a.go (+1/-1)
+
+`
+	if got != want {
+		t.Errorf("hnk split --dry-run =\n%s\nwant\n%s", got, want)
+	}
+
+	if out := runGit(t, dir, "diff", "--cached", "--name-only"); out != "" {
+		t.Errorf("the dry run touched the index: %q", out)
+	}
+}
+
+func TestSplit(t *testing.T) {
+	dir := splitRepo(t)
+	hnk(t, dir, "split", "split")
+
+	commits := []struct {
+		rev, message, files string
+	}{
+		{rev: "HEAD~1", message: "Greet the world\n\nChange the greeting and the name.\n", files: "a.go\nb.go\n"},
+		{rev: "HEAD", message: "Count every item\n\nFix an off-by-one in Count.\n", files: "a.go\n"},
+	}
+	for _, c := range commits {
+		if got := runGit(t, dir, "log", "-1", "--format=%B", c.rev); got != c.message+"\n" {
+			t.Errorf("%s message = %q, want %q", c.rev, got, c.message)
+		}
+		if got := runGit(t, dir, "diff", "--name-only", c.rev+"~", c.rev); got != c.files {
+			t.Errorf("%s changes %q, want %q", c.rev, got, c.files)
+		}
+	}
+	if out := runGit(t, dir, "status", "--porcelain"); out != "" {
+		t.Errorf("changes left after the split:\n%s", out)
+	}
+}
+
+func TestCommitSplitRestoresIndex(t *testing.T) {
+	for _, kv := range gitEnv {
+		k, v, _ := strings.Cut(kv, "=")
+		t.Setenv(k, v)
+	}
+	const patch = "diff --git a/b.go b/b.go\n--- a/b.go\n+++ b/b.go\n@@ -1,3 +1,3 @@\n package demo\n \n-const Name = \"demo\"\n+const Name = \"hnk demo\"\n"
+
+	tests := []struct {
+		name    string
+		patch   string
+		hook    string
+		wantErr string
+	}{
+		{
+			name:    "patch does not apply",
+			patch:   strings.ReplaceAll(patch, "package demo", "package other"),
+			wantErr: "failed to stage",
+		},
+		{
+			name:    "commit fails",
+			patch:   patch,
+			hook:    "#!/bin/sh\nexit 1\n",
+			wantErr: "failed to commit",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := splitRepo(t)
+			// Stage the change to a.go, so there is an index to restore.
+			runGit(t, dir, "add", "a.go")
+			if tt.hook != "" {
+				if err := os.WriteFile(filepath.Join(dir, ".git", "hooks", "pre-commit"), []byte(tt.hook), 0755); err != nil {
+					t.Fatal(err)
+				}
+			}
+			tree := runGit(t, dir, "write-tree")
+			head := runGit(t, dir, "rev-parse", "HEAD")
+
+			err := commitSplit(context.Background(), git.NewRepository(dir), splitCommit{title: "Rename", patch: tt.patch})
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("commitSplit = %v, want %q", err, tt.wantErr)
+			}
+			if got := runGit(t, dir, "write-tree"); got != tree {
+				t.Errorf("the index is %s, want it restored to %s", got, tree)
+			}
+			if got := runGit(t, dir, "rev-parse", "HEAD"); got != head {
+				t.Errorf("HEAD moved to %s", got)
+			}
+			if got := runGit(t, dir, "diff", "--name-only"); got != "b.go\n" {
+				t.Errorf("unstaged changes = %q", got)
+			}
+		})
+	}
+}
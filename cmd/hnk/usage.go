@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jm/hnk/internal/ai"
+	"github.com/jm/hnk/internal/grouper"
+	"github.com/jm/hnk/internal/usage"
+	"github.com/urfave/cli/v3"
+)
+
+func usageCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "usage",
+		Usage: "Show token usage and estimated cost by day and model",
+		Flags: []cli.Flag{
+			&cli.IntFlag{
+				Name:  "days",
+				Usage: "Only include the last N days (0 for all)",
+			},
+		},
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			return runUsage(int(cmd.Int("days")))
+		},
+	}
+}
+
+func runUsage(days int) error {
+	path := usage.LedgerPath()
+	entries, err := usage.Load(path)
+	if err != nil {
+		return fmt.Errorf("failed to read usage ledger: %w", err)
+	}
+
+	if days > 0 {
+		cutoff := time.Now().AddDate(0, 0, -days)
+		var recent []usage.Entry
+		for _, e := range entries {
+			if e.Time.After(cutoff) {
+				recent = append(recent, e)
+			}
+		}
+		entries = recent
+	}
+
+	if len(entries) == 0 {
+		fmt.Println("No usage recorded yet")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "DAY\tMODEL\tCALLS\tINPUT\tOUTPUT\tCOST\t")
+	var total usage.Total
+	for _, t := range usage.Summarize(entries) {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%d\t$%.4f\t\n", t.Day, t.Model, t.Calls, t.InputTokens, t.OutputTokens, t.CostUSD)
+		total.Calls += t.Calls
+		total.InputTokens += t.InputTokens
+		total.OutputTokens += t.OutputTokens
+		total.CostUSD += t.CostUSD
+	}
+	fmt.Fprintf(w, "total\t\t%d\t%d\t%d\t$%.4f\t\n", total.Calls, total.InputTokens, total.OutputTokens, total.CostUSD)
+	return w.Flush()
+}
+
+func recordUsage(cmd *cli.Command, grp *grouper.Grouper) {
+	report := grp.Report()
+	u := report.Usage
+
+	perModel := report.ModelUsage
+	if len(perModel) == 0 && u.Calls > 0 {
+		perModel = []ai.Usage{u}
+	}
+	now := time.Now()
+	for _, mu := range perModel {
+		err := usage.Append(usage.LedgerPath(), usage.Entry{
+			Time:         now,
+			Command:      cmd.Name,
+			Model:        mu.Model,
+			Calls:        mu.Calls,
+			InputTokens:  mu.InputTokens,
+			OutputTokens: mu.OutputTokens,
+			CostUSD:      mu.CostUSD,
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "warning: failed to record usage: %s\n", oneLine(err.Error()))
+			break
+		}
+	}
+
+	for _, fb := range report.Fallbacks {
+		attempts := ""
+		if fb.Attempts > 1 {
+			attempts = fmt.Sprintf(" after %d attempts", fb.Attempts)
+		}
+		fmt.Fprintf(os.Stderr, "fallback: %s failed%s: %s\n", fb.Model, attempts, oneLine(fb.Reason))
+	}
+	if report.Model != "" && (len(report.Fallbacks) > 0 || cmd.Bool("verbose")) {
+		fmt.Fprintf(os.Stderr, "model: %s\n", report.Model)
+	}
+	if report.MergeErr != nil {
+		fmt.Fprintf(os.Stderr, "AI merge failed, showing the groups of each batch: %s\n", oneLine(report.MergeErr.Error()))
+	}
+	if report.Err != nil {
+		fmt.Fprintf(os.Stderr, "AI analysis failed, showing heuristic grouping: %s\n", oneLine(report.Err.Error()))
+	}
+
+	if !cmd.Bool("verbose") {
+		return
+	}
+	switch {
+	case u.Calls > 0:
+		fmt.Fprintf(os.Stderr, "usage: %s\n", u)
+	case report.Cached && report.CachedUsage != nil:
+		fmt.Fprintf(os.Stderr, "usage: served from cache (original analysis: %s)\n", *report.CachedUsage)
+	case report.Cached:
+		fmt.Fprintln(os.Stderr, "usage: served from cache")
+	default:
+		fmt.Fprintln(os.Stderr, "usage: no AI calls")
+	}
+}
+
+func oneLine(s string) string {
+	var parts []string
+	for _, line := range strings.Split(s, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			parts = append(parts, line)
+		}
+	}
+	return strings.Join(parts, ": ")
+}
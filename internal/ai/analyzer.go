@@ -0,0 +1,254 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jm/hnk/internal/pool"
+)
+
+type Analyzer interface {
+	AnalyzeDiff(ctx context.Context, catalog *DiffCatalog, rawDiff string) (*SemanticAnalysis, error)
+	GenerateDescription(ctx context.Context, diffText string) (string, error)
+	Ask(ctx context.Context, diffText string, history []Exchange, question string) (string, error)
+}
+
+type Exchange struct {
+	Question string
+	Answer   string
+}
+
+type Completer interface {
+	Complete(ctx context.Context, prompt string) (string, error)
+}
+
+type JSONCompleter interface {
+	CompleteJSON(ctx context.Context, prompt string) (string, error)
+}
+
+type Client struct {
+	MaxPromptTokens int
+	MaxRetries      int
+	Concurrency     int
+
+	completer Completer
+}
+
+func NewClient(c Completer) *Client {
+	return &Client{
+		MaxPromptTokens: DefaultMaxPromptTokens,
+		MaxRetries:      DefaultMaxRetries,
+		Concurrency:     pool.DefaultLimit,
+		completer:       c,
+	}
+}
+
+func (c *Client) AnalyzeDiff(ctx context.Context, catalog *DiffCatalog, rawDiff string) (*SemanticAnalysis, error) {
+	prompt := buildAnalysisPrompt(catalog, rawDiff)
+	if c.exceedsBudget(catalog, prompt) {
+		return c.analyzeChunked(ctx, catalog)
+	}
+	return c.analyzePrompt(ctx, catalog, prompt)
+}
+
+func (c *Client) exceedsBudget(catalog *DiffCatalog, prompt string) bool {
+	return c.MaxPromptTokens > 0 && estimateTokens(prompt) > c.MaxPromptTokens && catalog.TotalHunks > 1
+}
+
+func (c *Client) analyzeOnce(ctx context.Context, catalog *DiffCatalog, rawDiff string) (*SemanticAnalysis, error) {
+	return c.analyzePrompt(ctx, catalog, buildAnalysisPrompt(catalog, rawDiff))
+}
+
+func (c *Client) analyzePrompt(ctx context.Context, catalog *DiffCatalog, prompt string) (*SemanticAnalysis, error) {
+	response, err := c.completeJSON(ctx, prompt)
+	if err != nil {
+		return nil, err
+	}
+	return c.validateResponse(ctx, catalog, prompt, response)
+}
+
+func (c *Client) validateResponse(ctx context.Context, catalog *DiffCatalog, prompt, response string) (*SemanticAnalysis, error) {
+	for attempt := 0; ; attempt++ {
+		var problems []string
+		analysis, err := parseAnalysisResponse(response)
+		if err != nil {
+			msg, _, _ := strings.Cut(err.Error(), "\n")
+			problems = []string{"the response is not valid JSON in the required format: " + msg}
+		} else {
+			problems = ValidateAnalysis(catalog, analysis)
+		}
+
+		if len(problems) == 0 {
+			return analysis, nil
+		}
+		if attempt >= c.MaxRetries {
+			return nil, &ValidationError{Problems: problems}
+		}
+
+		response, err = c.completeJSON(ctx, buildCorrectionPrompt(prompt, response, problems))
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (c *Client) completeJSON(ctx context.Context, prompt string) (string, error) {
+	if jc, ok := c.completer.(JSONCompleter); ok {
+		return jc.CompleteJSON(ctx, prompt)
+	}
+	return c.completer.Complete(ctx, prompt)
+}
+
+func (c *Client) GenerateDescription(ctx context.Context, diffText string) (string, error) {
+	response, err := c.completer.Complete(ctx, buildDescriptionPrompt(diffText))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(response), nil
+}
+
+func (c *Client) Usage() Usage {
+	if r, ok := c.completer.(UsageReporter); ok {
+		return r.Usage()
+	}
+	return Usage{}
+}
+
+func (c *Client) ModelUsage() []Usage {
+	if r, ok := c.completer.(ModelUsageReporter); ok {
+		return r.ModelUsage()
+	}
+	return nil
+}
+
+func (c *Client) ActiveModel() string {
+	if r, ok := c.completer.(ModelReporter); ok {
+		return r.ActiveModel()
+	}
+	return ""
+}
+
+func (c *Client) Fallbacks() []FallbackEvent {
+	if r, ok := c.completer.(ModelReporter); ok {
+		return r.Fallbacks()
+	}
+	return nil
+}
+
+func (c *Client) Ask(ctx context.Context, diffText string, history []Exchange, question string) (string, error) {
+	response, err := c.completer.Complete(ctx, buildQuestionPrompt(diffText, history, question))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(response), nil
+}
+
+const (
+	DefaultProvider   = "claude-cli"
+	ProviderAnthropic = "anthropic"
+	ProviderOpenAI    = "openai"
+)
+
+type Options struct {
+	Provider string
+	Model    string
+	APIKey   string
+	BaseURL  string
+	JSONMode bool
+
+	MaxPromptTokens int
+	MaxRetries      int
+	Concurrency     int
+
+	Timeout        time.Duration
+	Retries        int
+	FallbackModels []string
+}
+
+func NewAnalyzer(opts Options) (Analyzer, error) {
+	c, err := NewCompleter(opts)
+	if err != nil {
+		return nil, err
+	}
+	client := NewClient(c)
+	if opts.MaxPromptTokens > 0 {
+		client.MaxPromptTokens = opts.MaxPromptTokens
+	}
+	client.MaxRetries = opts.MaxRetries
+	if opts.Concurrency > 0 {
+		client.Concurrency = opts.Concurrency
+	}
+	return client, nil
+}
+
+func NewCompleter(opts Options) (Completer, error) {
+	if setting := os.Getenv(FixtureEnv); setting != "" {
+		return fixtureCompleter(setting, opts)
+	}
+	return newBackend(opts)
+}
+
+func newBackend(opts Options) (Completer, error) {
+	var models []string
+	var completers []Completer
+	for _, model := range append([]string{opts.Model}, opts.FallbackModels...) {
+		if slices.Contains(models, model) {
+			continue
+		}
+		c, err := newProvider(opts, model)
+		if err != nil {
+			return nil, err
+		}
+		if model == "" {
+			model = defaultModel(c)
+		}
+		models = append(models, model)
+		completers = append(completers, c)
+	}
+	return NewFallback(models, completers, RetryPolicy{Retries: opts.Retries}), nil
+}
+
+func newProvider(opts Options, model string) (Completer, error) {
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = DefaultCallTimeout
+	}
+	switch opts.Provider {
+	case "", DefaultProvider:
+		c := NewClaudeCLI(model)
+		c.Timeout = timeout
+		return c, nil
+	case ProviderAnthropic:
+		c, err := NewAnthropicAPI(model, opts.APIKey, opts.BaseURL)
+		if err != nil {
+			return nil, err
+		}
+		c.Timeout = timeout
+		return c, nil
+	case ProviderOpenAI:
+		c, err := NewOpenAICompatible(model, opts.APIKey, opts.BaseURL, opts.JSONMode)
+		if err != nil {
+			return nil, err
+		}
+		c.Timeout = timeout
+		return c, nil
+	default:
+		return nil, fmt.Errorf("unknown AI provider: %s", opts.Provider)
+	}
+}
+
+func defaultModel(c Completer) string {
+	switch c := c.(type) {
+	case *ClaudeCLI:
+		return c.Model
+	case *AnthropicAPI:
+		return c.Model
+	case *OpenAICompatible:
+		return c.Model
+	}
+	return ""
+}
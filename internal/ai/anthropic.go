@@ -0,0 +1,248 @@
+package ai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultAnthropicBaseURL = "https://api.anthropic.com"
+	anthropicVersion        = "2023-06-01"
+)
+
+var anthropicModelAliases = map[string]string{
+	"haiku":  "claude-haiku-4-5",
+	"sonnet": "claude-sonnet-4-5",
+	"opus":   "claude-opus-4-1",
+}
+
+type AnthropicAPI struct {
+	Model      string
+	APIKey     string
+	BaseURL    string
+	MaxTokens  int
+	Timeout    time.Duration
+	HTTPClient *http.Client
+
+	usageMeter
+}
+
+func NewAnthropicAPI(model, apiKey, baseURL string) (*AnthropicAPI, error) {
+	if model == "" {
+		model = "sonnet"
+	}
+	if alias, ok := anthropicModelAliases[model]; ok {
+		model = alias
+	}
+	if apiKey == "" {
+		apiKey = os.Getenv("ANTHROPIC_API_KEY")
+	}
+	if apiKey == "" {
+		return nil, fmt.Errorf("anthropic: no API key (set ANTHROPIC_API_KEY or anthropic.api_key in config)")
+	}
+	if baseURL == "" {
+		baseURL = os.Getenv("ANTHROPIC_BASE_URL")
+	}
+	if baseURL == "" {
+		baseURL = DefaultAnthropicBaseURL
+	}
+	return &AnthropicAPI{
+		Model:      model,
+		APIKey:     apiKey,
+		BaseURL:    strings.TrimSuffix(baseURL, "/"),
+		MaxTokens:  8192,
+		Timeout:    120 * time.Second,
+		HTTPClient: http.DefaultClient,
+	}, nil
+}
+
+type anthropicMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type anthropicRequest struct {
+	Model     string             `json:"model"`
+	MaxTokens int                `json:"max_tokens"`
+	Messages  []anthropicMessage `json:"messages"`
+	Stream    bool               `json:"stream,omitempty"`
+}
+
+type anthropicError struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+// streamErrorStatus maps the errors Anthropic sends in the middle of a
+// stream to the status they would have had before it started.
+var streamErrorStatus = map[string]int{
+	"rate_limit_error": http.StatusTooManyRequests,
+	"api_error":        http.StatusInternalServerError,
+	"overloaded_error": 529,
+}
+
+func (e *anthropicError) httpError() error {
+	code, ok := streamErrorStatus[e.Type]
+	if !ok {
+		return fmt.Errorf("anthropic: %s", e.Message)
+	}
+	return &HTTPError{Provider: "anthropic", StatusCode: code, Status: e.Type, Message: e.Message}
+}
+
+type anthropicResponse struct {
+	Content []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"content"`
+	Model      string          `json:"model"`
+	StopReason string          `json:"stop_reason"`
+	Usage      anthropicUsage  `json:"usage"`
+	Error      *anthropicError `json:"error"`
+}
+
+type anthropicUsage struct {
+	InputTokens              int `json:"input_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+}
+
+func (u anthropicUsage) input() int {
+	return u.InputTokens + u.CacheCreationInputTokens + u.CacheReadInputTokens
+}
+
+type anthropicStreamEvent struct {
+	Type  string `json:"type"`
+	Delta struct {
+		Type       string `json:"type"`
+		Text       string `json:"text"`
+		StopReason string `json:"stop_reason"`
+	} `json:"delta"`
+	Message anthropicResponse `json:"message"`
+	Usage   anthropicUsage    `json:"usage"`
+	Error   *anthropicError   `json:"error"`
+}
+
+func (a *AnthropicAPI) Complete(ctx context.Context, prompt string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, a.Timeout)
+	defer cancel()
+
+	resp, err := a.post(ctx, prompt, false)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("anthropic: %w", err)
+	}
+
+	var parsed anthropicResponse
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		return "", fmt.Errorf("anthropic: %s: %s", resp.Status, data)
+	}
+	a.record(a.Model, parsed.Usage.input(), parsed.Usage.OutputTokens, -1)
+
+	var sb strings.Builder
+	for _, block := range parsed.Content {
+		if block.Type == "text" {
+			sb.WriteString(block.Text)
+		}
+	}
+	if parsed.StopReason == "max_tokens" {
+		return "", fmt.Errorf("anthropic: response truncated at %d tokens", a.MaxTokens)
+	}
+	return sb.String(), nil
+}
+
+func (a *AnthropicAPI) CompleteJSONStream(ctx context.Context, prompt string, onText func(string)) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, a.Timeout)
+	defer cancel()
+
+	resp, err := a.post(ctx, prompt, true)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var sb strings.Builder
+	var stopReason string
+	var usage anthropicUsage
+	err = readSSE(resp.Body, func(data string) error {
+		var event anthropicStreamEvent
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			return nil
+		}
+		switch event.Type {
+		case "message_start":
+			usage = event.Message.Usage
+		case "content_block_delta":
+			if event.Delta.Type == "text_delta" {
+				sb.WriteString(event.Delta.Text)
+				onText(event.Delta.Text)
+			}
+		case "message_delta":
+			stopReason = event.Delta.StopReason
+			usage.OutputTokens = event.Usage.OutputTokens
+		case "error":
+			if event.Error != nil {
+				return event.Error.httpError()
+			}
+			return fmt.Errorf("anthropic: stream error")
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	a.record(a.Model, usage.input(), usage.OutputTokens, -1)
+	if stopReason == "max_tokens" {
+		return "", fmt.Errorf("anthropic: response truncated at %d tokens", a.MaxTokens)
+	}
+	return sb.String(), nil
+}
+
+func (a *AnthropicAPI) post(ctx context.Context, prompt string, stream bool) (*http.Response, error) {
+	body, err := json.Marshal(anthropicRequest{
+		Model:     a.Model,
+		MaxTokens: a.MaxTokens,
+		Messages:  []anthropicMessage{{Role: "user", Content: prompt}},
+		Stream:    stream,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.BaseURL+"/v1/messages", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("content-type", "application/json")
+	req.Header.Set("x-api-key", a.APIKey)
+	req.Header.Set("anthropic-version", anthropicVersion)
+
+	resp, err := a.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("anthropic: %w", err)
+	}
+	if resp.StatusCode == http.StatusOK {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+
+	data, _ := io.ReadAll(resp.Body)
+	var parsed anthropicResponse
+	httpErr := &HTTPError{Provider: "anthropic", StatusCode: resp.StatusCode, Status: resp.Status}
+	if err := json.Unmarshal(data, &parsed); err == nil && parsed.Error != nil {
+		httpErr.Message = parsed.Error.Message
+	}
+	return nil, httpErr
+}
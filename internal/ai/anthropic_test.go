@@ -0,0 +1,257 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// anthropicServer answers every request with handler, after checking that
+// it is a well-formed Messages API call.
+func anthropicServer(t *testing.T, wantStream bool, handler func(w http.ResponseWriter)) *AnthropicAPI {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/messages" {
+			t.Errorf("path = %s, want /v1/messages", r.URL.Path)
+		}
+		if got := r.Header.Get("x-api-key"); got != "key" {
+			t.Errorf("x-api-key = %q, want key", got)
+		}
+		if got := r.Header.Get("anthropic-version"); got != anthropicVersion {
+			t.Errorf("anthropic-version = %q, want %q", got, anthropicVersion)
+		}
+		var req anthropicRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("request body: %v", err)
+		}
+		if req.Model != "claude-haiku-4-5" || req.Stream != wantStream || len(req.Messages) != 1 || req.Messages[0].Content != "prompt" {
+			t.Errorf("request = %+v", req)
+		}
+		handler(w)
+	}))
+	t.Cleanup(srv.Close)
+
+	a, err := NewAnthropicAPI("haiku", "key", srv.URL+"/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func TestAnthropicComplete(t *testing.T) {
+	tests := []struct {
+		name      string
+		body      string
+		want      string
+		wantErr   string
+		wantUsage Usage
+	}{
+		{
+			name:      "text blocks",
+			body:      `{"content": [{"type": "text", "text": "hello "}, {"type": "tool_use"}, {"type": "text", "text": "world"}], "stop_reason": "end_turn", "usage": {"input_tokens": 10, "cache_read_input_tokens": 5, "output_tokens": 3}}`,
+			want:      "hello world",
+			wantUsage: Usage{Model: "claude-haiku-4-5", Calls: 1, InputTokens: 15, OutputTokens: 3, CostUSD: EstimateCost("claude-haiku-4-5", 15, 3)},
+		},
+		{
+			name:      "truncated",
+			body:      `{"content": [{"type": "text", "text": "{\"gro"}], "stop_reason": "max_tokens", "usage": {"input_tokens": 10, "output_tokens": 8192}}`,
+			wantErr:   "response truncated at 8192 tokens",
+			wantUsage: Usage{Model: "claude-haiku-4-5", Calls: 1, InputTokens: 10, OutputTokens: 8192, CostUSD: EstimateCost("claude-haiku-4-5", 10, 8192)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := anthropicServer(t, false, func(w http.ResponseWriter) {
+				fmt.Fprint(w, tt.body)
+			})
+			got, err := a.Complete(context.Background(), "prompt")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("Complete = %q, want %q", got, tt.want)
+			}
+			if u := a.Usage(); u != tt.wantUsage {
+				t.Errorf("Usage = %+v, want %+v", u, tt.wantUsage)
+			}
+		})
+	}
+}
+
+func TestAnthropicStream(t *testing.T) {
+	tests := []struct {
+		name          string
+		events        []string
+		want          string
+		wantText      []string
+		wantErr       string
+		wantTransient bool
+		wantUsage     Usage
+	}{
+		{
+			name: "text deltas",
+			events: []string{
+				`{"type": "message_start", "message": {"usage": {"input_tokens": 20, "output_tokens": 1}}}`,
+				`{"type": "content_block_start", "index": 0}`,
+				`{"type": "content_block_delta", "delta": {"type": "text_delta", "text": "{\"groups\""}}`,
+				`{"type": "ping"}`,
+				`{"type": "content_block_delta", "delta": {"type": "text_delta", "text": ": []}"}}`,
+				`{"type": "message_delta", "delta": {"stop_reason": "end_turn"}, "usage": {"output_tokens": 7}}`,
+				`{"type": "message_stop"}`,
+			},
+			want:      `{"groups": []}`,
+			wantText:  []string{`{"groups"`, `: []}`},
+			wantUsage: Usage{Model: "claude-haiku-4-5", Calls: 1, InputTokens: 20, OutputTokens: 7, CostUSD: EstimateCost("claude-haiku-4-5", 20, 7)},
+		},
+		{
+			name: "overloaded mid-stream",
+			events: []string{
+				`{"type": "message_start", "message": {"usage": {"input_tokens": 20}}}`,
+				`{"type": "content_block_delta", "delta": {"type": "text_delta", "text": "{"}}`,
+				`{"type": "error", "error": {"type": "overloaded_error", "message": "Overloaded"}}`,
+			},
+			wantText:      []string{"{"},
+			wantErr:       "Overloaded",
+			wantTransient: true,
+		},
+		{
+			name: "invalid request mid-stream",
+			events: []string{
+				`{"type": "error", "error": {"type": "invalid_request_error", "message": "bad"}}`,
+			},
+			wantErr: "anthropic: bad",
+		},
+		{
+			name: "truncated",
+			events: []string{
+				`{"type": "message_start", "message": {"usage": {"input_tokens": 20}}}`,
+				`{"type": "message_delta", "delta": {"stop_reason": "max_tokens"}, "usage": {"output_tokens": 8192}}`,
+			},
+			wantErr:   "response truncated",
+			wantUsage: Usage{Model: "claude-haiku-4-5", Calls: 1, InputTokens: 20, OutputTokens: 8192, CostUSD: EstimateCost("claude-haiku-4-5", 20, 8192)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := anthropicServer(t, true, func(w http.ResponseWriter) {
+				w.Header().Set("content-type", "text/event-stream")
+				for _, e := range tt.events {
+					var typ struct{ Type string }
+					json.Unmarshal([]byte(e), &typ)
+					fmt.Fprintf(w, "event: %s\ndata: %s\n\n", typ.Type, e)
+				}
+			})
+
+			var text []string
+			got, err := a.CompleteJSONStream(context.Background(), "prompt", func(s string) {
+				text = append(text, s)
+			})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				if IsTransient(err) != tt.wantTransient {
+					t.Errorf("IsTransient(%v) = %v, want %v", err, !tt.wantTransient, tt.wantTransient)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("CompleteJSONStream = %q, want %q", got, tt.want)
+			}
+			if !reflect.DeepEqual(text, tt.wantText) {
+				t.Errorf("streamed %q, want %q", text, tt.wantText)
+			}
+			if u := a.Usage(); u != tt.wantUsage {
+				t.Errorf("Usage = %+v, want %+v", u, tt.wantUsage)
+			}
+		})
+	}
+}
+
+func TestAnthropicHTTPErrors(t *testing.T) {
+	tests := []struct {
+		status        int
+		body          string
+		wantMessage   string
+		wantTransient bool
+	}{
+		{status: http.StatusTooManyRequests, body: `{"type": "error", "error": {"type": "rate_limit_error", "message": "slow down"}}`, wantMessage: "slow down", wantTransient: true},
+		{status: 529, body: `{"type": "error", "error": {"type": "overloaded_error", "message": "Overloaded"}}`, wantMessage: "Overloaded", wantTransient: true},
+		{status: http.StatusInternalServerError, body: `oops`, wantTransient: true},
+		{status: http.StatusServiceUnavailable, wantTransient: true},
+		{status: http.StatusBadRequest, body: `{"type": "error", "error": {"type": "invalid_request_error", "message": "prompt is too long"}}`, wantMessage: "prompt is too long"},
+		{status: http.StatusUnauthorized, body: `{"type": "error", "error": {"type": "authentication_error", "message": "invalid x-api-key"}}`, wantMessage: "invalid x-api-key"},
+		{status: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.status), func(t *testing.T) {
+			for _, stream := range []bool{false, true} {
+				a := anthropicServer(t, stream, func(w http.ResponseWriter) {
+					w.WriteHeader(tt.status)
+					fmt.Fprint(w, tt.body)
+				})
+				var err error
+				if stream {
+					_, err = a.CompleteJSONStream(context.Background(), "prompt", func(string) {})
+				} else {
+					_, err = a.Complete(context.Background(), "prompt")
+				}
+
+				httpErr, ok := err.(*HTTPError)
+				if !ok {
+					t.Fatalf("stream=%v: err = %T %v, want *HTTPError", stream, err, err)
+				}
+				if httpErr.StatusCode != tt.status || httpErr.Message != tt.wantMessage {
+					t.Errorf("stream=%v: err = %+v, want status %d and message %q", stream, httpErr, tt.status, tt.wantMessage)
+				}
+				if IsTransient(err) != tt.wantTransient {
+					t.Errorf("stream=%v: IsTransient = %v, want %v", stream, !tt.wantTransient, tt.wantTransient)
+				}
+			}
+		})
+	}
+}
+
+func TestNewAnthropicAPI(t *testing.T) {
+	t.Setenv("ANTHROPIC_API_KEY", "env-key")
+	t.Setenv("ANTHROPIC_BASE_URL", "http://proxy.local/")
+
+	tests := []struct {
+		name                     string
+		model, apiKey, baseURL   string
+		wantModel, wantKey, want string
+	}{
+		{name: "defaults from the environment", wantModel: "claude-sonnet-4-5", wantKey: "env-key", want: "http://proxy.local"},
+		{name: "explicit settings", model: "claude-opus-4-5", apiKey: "key", baseURL: "http://other", wantModel: "claude-opus-4-5", wantKey: "key", want: "http://other"},
+		{name: "alias", model: "opus", wantModel: "claude-opus-4-1", wantKey: "env-key", want: "http://proxy.local"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := NewAnthropicAPI(tt.model, tt.apiKey, tt.baseURL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if a.Model != tt.wantModel || a.APIKey != tt.wantKey || a.BaseURL != tt.want {
+				t.Errorf("got model %q, key %q, base URL %q", a.Model, a.APIKey, a.BaseURL)
+			}
+		})
+	}
+
+	t.Setenv("ANTHROPIC_API_KEY", "")
+	if _, err := NewAnthropicAPI("", "", ""); err == nil {
+		t.Error("no error without an API key")
+	}
+}
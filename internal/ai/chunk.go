@@ -0,0 +1,410 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/jm/hnk/internal/pool"
+)
+
+const (
+	DefaultMaxPromptTokens = 60000
+	promptOverheadTokens   = 1000
+)
+
+type progressKey struct{}
+
+// WithProgress attaches a callback that is told how many of the batches of
+// a large diff have been analyzed.
+func WithProgress(ctx context.Context, progress func(done, total int)) context.Context {
+	return context.WithValue(ctx, progressKey{}, pool.Progress(progress))
+}
+
+func progressFrom(ctx context.Context) pool.Progress {
+	progress, _ := ctx.Value(progressKey{}).(pool.Progress)
+	return progress
+}
+
+func estimateTokens(s string) int {
+	return len(s)/4 + 1
+}
+
+type catalogBatch struct {
+	catalog *DiffCatalog
+	rawDiff string
+	files   []int
+	hunks   [][]int
+	// prefix keeps group ids from different batches apart, e.g. "b2/".
+	prefix string
+}
+
+func splitCatalog(catalog *DiffCatalog, budget int) []catalogBatch {
+	budget -= promptOverheadTokens
+	if budget < 1 {
+		budget = 1
+	}
+
+	var batches []catalogBatch
+	var current *catalogBatch
+	used := 0
+
+	for _, f := range catalog.Files {
+		for _, h := range f.Hunks {
+			cost := estimateTokens(h.Text) + estimateTokens(h.Context) + estimateTokens(f.DiffHeader) + 20
+			if current == nil || (used+cost > budget && current.catalog.TotalHunks > 0) {
+				batches = append(batches, catalogBatch{catalog: &DiffCatalog{}})
+				current = &batches[len(batches)-1]
+				used = 0
+			}
+			current.add(f, h)
+			used += cost
+		}
+	}
+
+	for i := range batches {
+		batches[i].rawDiff = batches[i].buildRawDiff()
+		if len(batches) > 1 {
+			batches[i].prefix = fmt.Sprintf("b%d/", i+1)
+		}
+	}
+	return batches
+}
+
+func (b *catalogBatch) add(f FileCatalog, h HunkCatalog) {
+	last := len(b.files) - 1
+	if last < 0 || b.files[last] != f.Index {
+		b.files = append(b.files, f.Index)
+		b.hunks = append(b.hunks, nil)
+		b.catalog.Files = append(b.catalog.Files, FileCatalog{
+			Index:      len(b.catalog.Files),
+			Path:       f.Path,
+			DiffHeader: f.DiffHeader,
+			IsNew:      f.IsNew,
+			IsDelete:   f.IsDelete,
+			Parents:    f.Parents,
+		})
+		last++
+	}
+
+	local := h
+	local.Index = len(b.hunks[last])
+	b.hunks[last] = append(b.hunks[last], h.Index)
+	b.catalog.Files[last].Hunks = append(b.catalog.Files[last].Hunks, local)
+	b.catalog.TotalHunks++
+}
+
+func (b *catalogBatch) buildRawDiff() string {
+	var sb strings.Builder
+	for _, f := range b.catalog.Files {
+		sb.WriteString(f.DiffHeader)
+		for _, h := range f.Hunks {
+			sb.WriteString(h.Text)
+		}
+	}
+	return sb.String()
+}
+
+func (b *catalogBatch) toGlobal(analysis *SemanticAnalysis) []SemanticGroup {
+	var groups []SemanticGroup
+	for _, g := range analysis.Groups {
+		if global, ok := b.groupToGlobal(g); ok {
+			groups = append(groups, global)
+		}
+	}
+	return groups
+}
+
+func (b *catalogBatch) groupToGlobal(g SemanticGroup) (SemanticGroup, bool) {
+	global := SemanticGroup{ID: b.globalID(g.ID), Title: g.Title, Description: g.Description,
+		Review: g.Review}
+	for _, dep := range g.DependsOn {
+		global.DependsOn = append(global.DependsOn, b.globalID(dep))
+	}
+	for _, child := range g.Children {
+		if c, ok := b.groupToGlobal(child); ok {
+			global.Children = append(global.Children, c)
+		}
+	}
+	for i, fileIdx := range g.FileIndices {
+		if fileIdx < 0 || fileIdx >= len(b.files) || i >= len(g.HunkIndices) {
+			continue
+		}
+		var hunks []int
+		for _, hunkIdx := range g.HunkIndices[i] {
+			if hunkIdx < 0 || hunkIdx >= len(b.hunks[fileIdx]) {
+				continue
+			}
+			hunks = append(hunks, b.hunks[fileIdx][hunkIdx])
+		}
+		if len(hunks) == 0 {
+			continue
+		}
+		global.FileIndices = append(global.FileIndices, b.files[fileIdx])
+		global.HunkIndices = append(global.HunkIndices, hunks)
+	}
+	return global, len(global.FileIndices) > 0 || len(global.Children) > 0
+}
+
+func (b *catalogBatch) globalID(id string) string {
+	if id == "" {
+		return ""
+	}
+	return b.prefix + id
+}
+
+func (c *Client) analyzeChunked(ctx context.Context, catalog *DiffCatalog) (*SemanticAnalysis, error) {
+	batches := splitCatalog(catalog, c.MaxPromptTokens)
+
+	results, err := pool.Map(ctx, c.Concurrency, batches, func(ctx context.Context, b catalogBatch) ([]SemanticGroup, error) {
+		analysis, err := c.analyzeOnce(ctx, b.catalog, b.rawDiff)
+		if err != nil {
+			return nil, err
+		}
+		return b.toGlobal(analysis), nil
+	}, progressFrom(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	var partial []SemanticGroup
+	for _, groups := range results {
+		partial = append(partial, groups...)
+	}
+
+	if len(batches) == 1 {
+		return &SemanticAnalysis{Groups: partial}, nil
+	}
+
+	merged, err := c.mergeGroups(ctx, catalog, partial)
+	if err == nil {
+		if problems := ValidateAnalysis(catalog, merged); len(problems) > 0 {
+			err = &ValidationError{Problems: problems}
+		}
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return &SemanticAnalysis{Groups: partial, MergeErr: fmt.Errorf("failed to merge batches: %w", err)}, nil
+	}
+	return merged, nil
+}
+
+type mergeGroup struct {
+	ID          string       `json:"id"`
+	Title       string       `json:"title"`
+	Description string       `json:"description"`
+	Members     []int        `json:"members"`
+	Children    []mergeGroup `json:"children"`
+	DependsOn   []string     `json:"depends_on"`
+}
+
+type mergeResponse struct {
+	Groups []mergeGroup `json:"groups"`
+}
+
+func (c *Client) mergeGroups(ctx context.Context, catalog *DiffCatalog, partial []SemanticGroup) (*SemanticAnalysis, error) {
+	var leaves []SemanticGroup
+	for i := range partial {
+		leaves = append(leaves, partial[i].Leaves()...)
+	}
+
+	response, err := c.completeJSON(ctx, buildMergePrompt(catalog, leaves))
+	if err != nil {
+		return nil, err
+	}
+
+	var parsed mergeResponse
+	if err := json.Unmarshal([]byte(trimFences(response)), &parsed); err != nil {
+		return nil, fmt.Errorf("failed to parse AI merge response: %w\nresponse was: %s", err, response)
+	}
+
+	used := make([]bool, len(leaves))
+	var groups []SemanticGroup
+	for _, mg := range parsed.Groups {
+		if group, ok := mg.resolve(leaves, used); ok {
+			groups = append(groups, group)
+		}
+	}
+	merged := len(groups)
+	for i, l := range leaves {
+		if !used[i] {
+			groups = append(groups, l)
+		}
+	}
+	relinkLeftovers(partial, groups[merged:], groups)
+	return &SemanticAnalysis{Groups: groups}, nil
+}
+
+type hunkKey struct {
+	file, hunk int
+}
+
+func hunkKeys(g *SemanticGroup) []hunkKey {
+	var keys []hunkKey
+	for _, leaf := range g.Leaves() {
+		for i, fileIdx := range leaf.FileIndices {
+			for _, hunkIdx := range leaf.HunkIndices[i] {
+				keys = append(keys, hunkKey{fileIdx, hunkIdx})
+			}
+		}
+	}
+	return keys
+}
+
+// relinkLeftovers rewrites the dependencies of the partial groups that the
+// merge left out. They still name groups of their batch, which may have been
+// merged away or sit at another level now, so each edge is pointed at the
+// final groups that hold the named group's hunks, and dropped if there are
+// none.
+func relinkLeftovers(partial, leftovers, groups []SemanticGroup) {
+	owner := make(map[hunkKey]string)
+	for i := range groups {
+		for _, k := range hunkKeys(&groups[i]) {
+			owner[k] = groups[i].ID
+		}
+	}
+
+	targets := make(map[string][]string)
+	var walk func(gs []SemanticGroup)
+	walk = func(gs []SemanticGroup) {
+		for i := range gs {
+			g := &gs[i]
+			for _, k := range hunkKeys(g) {
+				if id := owner[k]; g.ID != "" && id != "" && !slices.Contains(targets[g.ID], id) {
+					targets[g.ID] = append(targets[g.ID], id)
+				}
+			}
+			walk(g.Children)
+		}
+	}
+	walk(partial)
+
+	for i := range leftovers {
+		g := &leftovers[i]
+		var deps []string
+		for _, dep := range g.DependsOn {
+			for _, id := range targets[dep] {
+				if id != g.ID && !slices.Contains(deps, id) {
+					deps = append(deps, id)
+				}
+			}
+		}
+		g.DependsOn = deps
+	}
+}
+
+func (mg *mergeGroup) resolve(leaves []SemanticGroup, used []bool) (SemanticGroup, bool) {
+	group := SemanticGroup{ID: mg.ID, Title: mg.Title, Description: mg.Description, DependsOn: mg.DependsOn}
+	for i := range mg.Children {
+		if child, ok := mg.Children[i].resolve(leaves, used); ok {
+			group.Children = append(group.Children, child)
+		}
+	}
+	if len(group.Children) > 0 {
+		return group, true
+	}
+
+	for _, m := range mg.Members {
+		if m < 0 || m >= len(leaves) || used[m] {
+			continue
+		}
+		used[m] = true
+		group = appendIndices(group, leaves[m])
+		group.Review.Merge(leaves[m].Review)
+	}
+	return group, len(group.FileIndices) > 0
+}
+
+func appendIndices(dst, src SemanticGroup) SemanticGroup {
+	for i, fileIdx := range src.FileIndices {
+		pos := -1
+		for j, existing := range dst.FileIndices {
+			if existing == fileIdx {
+				pos = j
+				break
+			}
+		}
+		if pos < 0 {
+			dst.FileIndices = append(dst.FileIndices, fileIdx)
+			dst.HunkIndices = append(dst.HunkIndices, nil)
+			pos = len(dst.FileIndices) - 1
+		}
+		dst.HunkIndices[pos] = append(dst.HunkIndices[pos], src.HunkIndices[i]...)
+	}
+	return dst
+}
+
+func buildMergePrompt(catalog *DiffCatalog, partial []SemanticGroup) string {
+	var sb strings.Builder
+	for i, g := range partial {
+		var paths []string
+		for _, fileIdx := range g.FileIndices {
+			paths = append(paths, catalog.Files[fileIdx].Path)
+		}
+		sb.WriteString(fmt.Sprintf("Group[%d]: %s\n  %s\n  files: %s\n", i, g.Title, g.Description, strings.Join(paths, ", ")))
+	}
+
+	return fmt.Sprintf(`# Partial Groups
+
+A large diff was analyzed in batches. Each batch produced the groups below.
+
+%s
+# Instructions
+
+Merge these partial groups into the final set of logical changes. Return ONLY valid JSON.
+
+RULES:
+- Create AT MOST %d top-level groups
+- Combine partial groups that belong to the same logical change, even if they came from different batches
+- Each partial group must appear in EXACTLY ONE final group (no duplicates)
+- Title should be imperative mood, <60 chars
+- Give every group a short unique id, and list in depends_on the ids of the groups at the same level a reader should understand first
+- List the groups in the order a reviewer should read them, so every group comes after the groups it depends on
+%s
+JSON format:
+{
+  "groups": [
+    {
+      "id": "auth",
+      "title": "Add user authentication",
+      "description": "One sentence explaining what and why",
+      "members": [0, 3],
+      "depends_on": []
+    }%s
+  ]
+}
+
+members: indices of the partial groups that make up this group
+
+Return ONLY JSON, no markdown fences.`, sb.String(), maxGroupsFor(catalog), mergeNestingRules(catalog), mergeNestedExample(catalog))
+}
+
+func mergeNestingRules(catalog *DiffCatalog) string {
+	if !allowNesting(catalog) {
+		return ""
+	}
+	return fmt.Sprintf(`- A top-level group MAY be a theme that holds sub-groups in "children" instead of members, when the theme has clearly separable parts
+- Sub-groups list members and cannot have children of their own; there are AT MOST %d sub-groups in total
+`, maxSubGroupsFor(catalog))
+}
+
+func mergeNestedExample(catalog *DiffCatalog) string {
+	if !allowNesting(catalog) {
+		return ""
+	}
+	return `,
+    {
+      "id": "oauth",
+      "title": "Add OAuth login",
+      "description": "One sentence explaining the theme",
+      "depends_on": ["auth"],
+      "children": [
+        {"id": "oauth-handler", "title": "Add OAuth callback handler", "description": "One sentence", "members": [1]},
+        {"id": "oauth-tests", "title": "Test the login flow", "description": "One sentence", "members": [2, 4], "depends_on": ["oauth-handler"]}
+      ]
+    }`
+}
@@ -0,0 +1,321 @@
+package ai
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// chunkCatalog has three hunks in a.go and one in b.go; each hunk costs 30
+// tokens of the budget.
+func chunkCatalog() *DiffCatalog {
+	return &DiffCatalog{
+		Files: []FileCatalog{
+			{Index: 0, Path: "a.go", DiffHeader: "diff --git a/a.go b/a.go\n", Hunks: []HunkCatalog{
+				{Index: 0, Text: "@@ a0\n"}, {Index: 1, Text: "@@ a1\n"}, {Index: 2, Text: "@@ a2\n"},
+			}},
+			{Index: 1, Path: "b.go", DiffHeader: "diff --git a/b.go b/b.go\n", Hunks: []HunkCatalog{
+				{Index: 0, Text: "@@ b0\n"},
+			}},
+		},
+		TotalHunks: 4,
+	}
+}
+
+// twoPerBatch is a budget that fits two hunks of chunkCatalog.
+const twoPerBatch = promptOverheadTokens + 70
+
+func TestSplitCatalog(t *testing.T) {
+	type batch struct {
+		files  []int
+		hunks  [][]int
+		prefix string
+		paths  []string
+		local  [][]int
+	}
+
+	tests := []struct {
+		name   string
+		budget int
+		want   []batch
+	}{
+		{
+			name:   "fits in one batch",
+			budget: DefaultMaxPromptTokens,
+			want: []batch{
+				{files: []int{0, 1}, hunks: [][]int{{0, 1, 2}, {0}}, paths: []string{"a.go", "b.go"}, local: [][]int{{0, 1, 2}, {0}}},
+			},
+		},
+		{
+			name:   "split within a file",
+			budget: twoPerBatch,
+			want: []batch{
+				{files: []int{0}, hunks: [][]int{{0, 1}}, prefix: "b1/", paths: []string{"a.go"}, local: [][]int{{0, 1}}},
+				{files: []int{0, 1}, hunks: [][]int{{2}, {0}}, prefix: "b2/", paths: []string{"a.go", "b.go"}, local: [][]int{{0}, {0}}},
+			},
+		},
+		{
+			name:   "hunks bigger than the budget get a batch each",
+			budget: 0,
+			want: []batch{
+				{files: []int{0}, hunks: [][]int{{0}}, prefix: "b1/", paths: []string{"a.go"}, local: [][]int{{0}}},
+				{files: []int{0}, hunks: [][]int{{1}}, prefix: "b2/", paths: []string{"a.go"}, local: [][]int{{0}}},
+				{files: []int{0}, hunks: [][]int{{2}}, prefix: "b3/", paths: []string{"a.go"}, local: [][]int{{0}}},
+				{files: []int{1}, hunks: [][]int{{0}}, prefix: "b4/", paths: []string{"b.go"}, local: [][]int{{0}}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []batch
+			for _, b := range splitCatalog(chunkCatalog(), tt.budget) {
+				summary := batch{files: b.files, hunks: b.hunks, prefix: b.prefix}
+				total := 0
+				for i, f := range b.catalog.Files {
+					if f.Index != i {
+						t.Errorf("batch file %s has index %d, want %d", f.Path, f.Index, i)
+					}
+					summary.paths = append(summary.paths, f.Path)
+					var local []int
+					for _, h := range f.Hunks {
+						local = append(local, h.Index)
+					}
+					summary.local = append(summary.local, local)
+					total += len(f.Hunks)
+				}
+				if b.catalog.TotalHunks != total {
+					t.Errorf("TotalHunks = %d, want %d", b.catalog.TotalHunks, total)
+				}
+				got = append(got, summary)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("batches =\n%+v\nwant\n%+v", got, tt.want)
+			}
+		})
+	}
+
+	batches := splitCatalog(chunkCatalog(), twoPerBatch)
+	if want := "diff --git a/a.go b/a.go\n@@ a2\ndiff --git a/b.go b/b.go\n@@ b0\n"; batches[1].rawDiff != want {
+		t.Errorf("rawDiff = %q, want %q", batches[1].rawDiff, want)
+	}
+}
+
+func TestGroupToGlobal(t *testing.T) {
+	// The second batch of chunkCatalog: a.go hunk 2 and b.go hunk 0.
+	b := splitCatalog(chunkCatalog(), twoPerBatch)[1]
+
+	tests := []struct {
+		name   string
+		group  SemanticGroup
+		want   SemanticGroup
+		wantOK bool
+	}{
+		{
+			name:   "indices and ids",
+			group:  SemanticGroup{ID: "x", Title: "X", FileIndices: []int{1, 0}, HunkIndices: [][]int{{0}, {0}}, DependsOn: []string{"y"}},
+			want:   SemanticGroup{ID: "b2/x", Title: "X", FileIndices: []int{1, 0}, HunkIndices: [][]int{{0}, {2}}, DependsOn: []string{"b2/y"}},
+			wantOK: true,
+		},
+		{
+			name:   "out of range indices are dropped",
+			group:  SemanticGroup{ID: "x", FileIndices: []int{0, 1, 2, -1}, HunkIndices: [][]int{{0, 3}, {-1}, {0}, {0}}},
+			want:   SemanticGroup{ID: "b2/x", FileIndices: []int{0}, HunkIndices: [][]int{{2}}},
+			wantOK: true,
+		},
+		{
+			name:  "no valid hunks",
+			group: SemanticGroup{ID: "x", FileIndices: []int{5}, HunkIndices: [][]int{{0}}},
+			want:  SemanticGroup{ID: "b2/x"},
+		},
+		{
+			name: "children",
+			group: SemanticGroup{ID: "t", Children: []SemanticGroup{
+				{ID: "x", FileIndices: []int{0}, HunkIndices: [][]int{{0}}},
+				{ID: "y", FileIndices: []int{3}, HunkIndices: [][]int{{0}}},
+				{ID: "z", FileIndices: []int{1}, HunkIndices: [][]int{{0}}, DependsOn: []string{"x"}},
+			}},
+			want: SemanticGroup{ID: "b2/t", Children: []SemanticGroup{
+				{ID: "b2/x", FileIndices: []int{0}, HunkIndices: [][]int{{2}}},
+				{ID: "b2/z", FileIndices: []int{1}, HunkIndices: [][]int{{0}}, DependsOn: []string{"b2/x"}},
+			}},
+			wantOK: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := b.groupToGlobal(tt.group)
+			if ok != tt.wantOK || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("groupToGlobal = %+v, %v, want %+v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestMergeGroups(t *testing.T) {
+	// partial holds the groups of three batches over a.go (file 0) and b.go
+	// (file 1); the theme of the last batch has two sub-groups.
+	partial := []SemanticGroup{
+		{ID: "b1/x", Title: "X", FileIndices: []int{0}, HunkIndices: [][]int{{0}}},
+		{ID: "b1/y", Title: "Y", FileIndices: []int{0}, HunkIndices: [][]int{{1}}, DependsOn: []string{"b1/x"}},
+		{ID: "b2/z", Title: "Z", FileIndices: []int{0}, HunkIndices: [][]int{{2}}, DependsOn: []string{"b2/t"}},
+		{ID: "b2/t", Title: "T", Children: []SemanticGroup{
+			{ID: "b2/t1", Title: "T1", FileIndices: []int{1}, HunkIndices: [][]int{{0}}},
+			{ID: "b2/t2", Title: "T2", FileIndices: []int{1}, HunkIndices: [][]int{{1}}, DependsOn: []string{"b2/t1"}},
+		}},
+	}
+	catalog := chunkCatalog()
+	catalog.Files[1].Hunks = append(catalog.Files[1].Hunks, HunkCatalog{Index: 1})
+	catalog.TotalHunks++
+
+	// The merge prompt numbers the leaves: 0 X, 1 Y, 2 Z, 3 T1, 4 T2.
+	tests := []struct {
+		name     string
+		response string
+		want     []SemanticGroup
+		wantErr  bool
+	}{
+		{
+			name:     "every leaf merged",
+			response: `{"groups": [{"id": "core", "title": "Core", "members": [0, 3]}, {"id": "rest", "title": "Rest", "members": [1, 2, 4], "depends_on": ["core"]}]}`,
+			want: []SemanticGroup{
+				{ID: "core", Title: "Core", FileIndices: []int{0, 1}, HunkIndices: [][]int{{0}, {0}}},
+				{ID: "rest", Title: "Rest", FileIndices: []int{0, 1}, HunkIndices: [][]int{{1, 2}, {1}}, DependsOn: []string{"core"}},
+			},
+		},
+		{
+			name:     "leftovers follow their dependencies into merged groups",
+			response: `{"groups": [{"id": "core", "title": "Core", "members": [0]}, {"id": "theme", "title": "Theme", "members": [3, 4]}]}`,
+			want: []SemanticGroup{
+				{ID: "core", Title: "Core", FileIndices: []int{0}, HunkIndices: [][]int{{0}}},
+				{ID: "theme", Title: "Theme", FileIndices: []int{1}, HunkIndices: [][]int{{0, 1}}},
+				{ID: "b1/y", Title: "Y", FileIndices: []int{0}, HunkIndices: [][]int{{1}}, DependsOn: []string{"core"}},
+				{ID: "b2/z", Title: "Z", FileIndices: []int{0}, HunkIndices: [][]int{{2}}, DependsOn: []string{"theme"}},
+			},
+		},
+		{
+			name:     "leftovers keep dependencies on each other and on split themes",
+			response: `{"groups": [{"id": "one", "title": "One", "members": [3]}, {"id": "two", "title": "Two", "members": [4, 9, 4]}]}`,
+			want: []SemanticGroup{
+				{ID: "one", Title: "One", FileIndices: []int{1}, HunkIndices: [][]int{{0}}},
+				{ID: "two", Title: "Two", FileIndices: []int{1}, HunkIndices: [][]int{{1}}},
+				{ID: "b1/x", Title: "X", FileIndices: []int{0}, HunkIndices: [][]int{{0}}},
+				{ID: "b1/y", Title: "Y", FileIndices: []int{0}, HunkIndices: [][]int{{1}}, DependsOn: []string{"b1/x"}},
+				{ID: "b2/z", Title: "Z", FileIndices: []int{0}, HunkIndices: [][]int{{2}}, DependsOn: []string{"one", "two"}},
+			},
+		},
+		{
+			name:     "nothing merged",
+			response: `{"groups": []}`,
+			want: []SemanticGroup{
+				{ID: "b1/x", Title: "X", FileIndices: []int{0}, HunkIndices: [][]int{{0}}},
+				{ID: "b1/y", Title: "Y", FileIndices: []int{0}, HunkIndices: [][]int{{1}}, DependsOn: []string{"b1/x"}},
+				{ID: "b2/z", Title: "Z", FileIndices: []int{0}, HunkIndices: [][]int{{2}}, DependsOn: []string{"b2/t1", "b2/t2"}},
+				{ID: "b2/t1", Title: "T1", FileIndices: []int{1}, HunkIndices: [][]int{{0}}},
+				{ID: "b2/t2", Title: "T2", FileIndices: []int{1}, HunkIndices: [][]int{{1}}, DependsOn: []string{"b2/t1"}},
+			},
+		},
+		{
+			name:     "not JSON",
+			response: `I merged them.`,
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewClient(completerFunc(func(ctx context.Context, prompt string) (string, error) {
+				return tt.response, nil
+			}))
+			got, err := c.mergeGroups(context.Background(), catalog, partial)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("no error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got.Groups, tt.want) {
+				t.Errorf("groups =\n%+v\nwant\n%+v", got.Groups, tt.want)
+			}
+			if problems := ValidateAnalysis(catalog, got); len(problems) > 0 {
+				t.Errorf("the merged analysis is invalid: %q", problems)
+			}
+		})
+	}
+}
+
+func TestAnalyzeChunked(t *testing.T) {
+	// Each batch of two hunks is answered with one group per hunk, the
+	// second depending on the first.
+	batchResponses := map[string]string{
+		"File[0]: a.go\n  Hunk[0]: lines 0-0 (+0/-0)\n  Hunk[1]": `{"groups": [
+			{"id": "first", "title": "First", "file_indices": [0], "hunk_indices": [[0]]},
+			{"id": "second", "title": "Second", "file_indices": [0], "hunk_indices": [[1]], "depends_on": ["first"]}]}`,
+		"File[1]: b.go": `{"groups": [
+			{"id": "first", "title": "Third", "file_indices": [0], "hunk_indices": [[0]]},
+			{"id": "second", "title": "Fourth", "file_indices": [1], "hunk_indices": [[0]], "depends_on": ["first"]}]}`,
+	}
+
+	tests := []struct {
+		name         string
+		merge        string
+		want         []SemanticGroup
+		wantMergeErr bool
+	}{
+		{
+			name:  "merged across batches",
+			merge: `{"groups": [{"id": "firsts", "title": "Firsts", "members": [0, 2]}]}`,
+			want: []SemanticGroup{
+				{ID: "firsts", Title: "Firsts", FileIndices: []int{0}, HunkIndices: [][]int{{0, 2}}},
+				{ID: "b1/second", Title: "Second", FileIndices: []int{0}, HunkIndices: [][]int{{1}}, DependsOn: []string{"firsts"}},
+				{ID: "b2/second", Title: "Fourth", FileIndices: []int{1}, HunkIndices: [][]int{{0}}, DependsOn: []string{"firsts"}},
+			},
+		},
+		{
+			name:  "failed merge falls back to the batches' groups",
+			merge: `{"groups": [`,
+			want: []SemanticGroup{
+				{ID: "b1/first", Title: "First", FileIndices: []int{0}, HunkIndices: [][]int{{0}}},
+				{ID: "b1/second", Title: "Second", FileIndices: []int{0}, HunkIndices: [][]int{{1}}, DependsOn: []string{"b1/first"}},
+				{ID: "b2/first", Title: "Third", FileIndices: []int{0}, HunkIndices: [][]int{{2}}},
+				{ID: "b2/second", Title: "Fourth", FileIndices: []int{1}, HunkIndices: [][]int{{0}}, DependsOn: []string{"b2/first"}},
+			},
+			wantMergeErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewClient(completerFunc(func(ctx context.Context, prompt string) (string, error) {
+				if strings.Contains(prompt, "# Partial Groups") {
+					return tt.merge, nil
+				}
+				for key, response := range batchResponses {
+					if strings.Contains(prompt, key) {
+						return response, nil
+					}
+				}
+				t.Errorf("unexpected prompt:\n%s", prompt)
+				return "", nil
+			}))
+			c.MaxPromptTokens = twoPerBatch
+			c.MaxRetries = 0
+
+			got, err := c.analyzeChunked(context.Background(), chunkCatalog())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (got.MergeErr != nil) != tt.wantMergeErr {
+				t.Errorf("MergeErr = %v, want an error: %v", got.MergeErr, tt.wantMergeErr)
+			}
+			if !reflect.DeepEqual(got.Groups, tt.want) {
+				t.Errorf("groups =\n%+v\nwant\n%+v", got.Groups, tt.want)
+			}
+		})
+	}
+}
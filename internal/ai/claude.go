@@ -1,29 +1,25 @@
 package ai
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
+	"net/http"
 	"os/exec"
+	"regexp"
+	"strconv"
 	"strings"
 	"time"
 )
 
-type SemanticGroup struct {
-	Title       string   `json:"title"`
-	Description string   `json:"description"`
-	FileIndices []int    `json:"file_indices"`
-	HunkIndices [][]int  `json:"hunk_indices"`
-}
-
-type SemanticAnalysis struct {
-	Groups []SemanticGroup `json:"groups"`
-}
-
 type ClaudeCLI struct {
 	Model   string
 	Timeout time.Duration
+
+	usageMeter
 }
 
 func NewClaudeCLI(model string) *ClaudeCLI {
@@ -36,184 +32,147 @@ func NewClaudeCLI(model string) *ClaudeCLI {
 	}
 }
 
-func (c *ClaudeCLI) AnalyzeDiff(ctx context.Context, catalog *DiffCatalog, rawDiff string) (*SemanticAnalysis, error) {
-	prompt := buildAnalysisPrompt(catalog, rawDiff)
-
+func (c *ClaudeCLI) Complete(ctx context.Context, prompt string) (string, error) {
 	ctx, cancel := context.WithTimeout(ctx, c.Timeout)
 	defer cancel()
 
-	cmd := exec.CommandContext(ctx, "claude", "--model", c.Model, "--print")
+	cmd := exec.CommandContext(ctx, "claude", "--model", c.Model, "--print", "--output-format", "json")
+	killOnCancel(cmd)
 	cmd.Stdin = strings.NewReader(prompt)
 
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
 
-	if err := cmd.Run(); err != nil {
-		return nil, fmt.Errorf("claude: %w\n%s", err, stderr.String())
+	// The CLI exits with an error after reporting a failed API call, but
+	// still prints its result and usage.
+	runErr := cmd.Run()
+	if runErr != nil && ctx.Err() != nil {
+		return "", fmt.Errorf("claude: %w", ctx.Err())
 	}
 
-	response := stdout.String()
-	return parseAnalysisResponse(response)
-}
-
-type DiffCatalog struct {
-	Files      []FileCatalog
-	TotalHunks int
-}
-
-type FileCatalog struct {
-	Index    int
-	Path     string
-	IsNew    bool
-	IsDelete bool
-	Hunks    []HunkCatalog
-}
-
-type HunkCatalog struct {
-	Index   int
-	Start   int
-	End     int
-	Header  string
-	Adds    int
-	Removes int
-}
-
-func buildAnalysisPrompt(catalog *DiffCatalog, rawDiff string) string {
-	var sb strings.Builder
-
-	sb.WriteString("# Diff Catalog\n\n")
-	for _, f := range catalog.Files {
-		status := ""
-		if f.IsNew {
-			status = " (new file)"
-		} else if f.IsDelete {
-			status = " (deleted)"
-		}
-		sb.WriteString(fmt.Sprintf("File[%d]: %s%s\n", f.Index, f.Path, status))
-		for _, h := range f.Hunks {
-			header := ""
-			if h.Header != "" {
-				header = fmt.Sprintf(" // %s", h.Header)
-			}
-			sb.WriteString(fmt.Sprintf("  Hunk[%d]: lines %d-%d (+%d/-%d)%s\n",
-				h.Index, h.Start, h.End, h.Adds, h.Removes, header))
+	var result claudeStreamEvent
+	if err := json.Unmarshal(stdout.Bytes(), &result); err != nil {
+		if runErr != nil {
+			return "", cliError(runErr, stderr.String())
 		}
+		return "", fmt.Errorf("claude: unexpected output: %s", stdout.String())
 	}
-
-	maxGroups := min(len(catalog.Files)+1, 4)
-
-	return fmt.Sprintf(`%s
-# Diff Content
-
-%s
-
-# Instructions
-
-Group these hunks into logical changes. Return ONLY valid JSON.
-
-RULES:
-- Create AT MOST %d groups (fewer is better, 1-2 is ideal)
-- Hunks from the same file should be in the same group unless they do completely different things
-- Each hunk must appear in EXACTLY ONE group (no duplicates)
-- You MUST specify explicit hunk_indices for every file - never omit them
-- Title should be imperative mood, <60 chars
-
-JSON format:
-{
-  "groups": [
-    {
-      "title": "Add user authentication",
-      "description": "One sentence explaining what and why",
-      "file_indices": [0, 1],
-      "hunk_indices": [[0, 1], [0]]
-    }
-  ]
+	c.recordUsage(&result)
+	if result.IsError {
+		return "", cliError(nil, result.Result)
+	}
+	return result.Result, nil
 }
 
-file_indices: which files (by index)
-hunk_indices: REQUIRED - for each file in file_indices, list its hunk indices
-
-Return ONLY JSON, no markdown fences.`, sb.String(), rawDiff, maxGroups)
-}
+var apiErrorRe = regexp.MustCompile(`API Error: (\d{3})\b`)
 
-func BuildCatalog(files []FileInfo) *DiffCatalog {
-	catalog := &DiffCatalog{}
-	for i, f := range files {
-		fc := FileCatalog{
-			Index:    i,
-			Path:     f.Path,
-			IsNew:    f.IsNew,
-			IsDelete: f.IsDeleted,
-		}
-		for j, h := range f.Hunks {
-			hc := HunkCatalog{
-				Index:   j,
-				Start:   h.Start,
-				End:     h.Start + h.Count,
-				Header:  h.Header,
-				Adds:    h.Adds,
-				Removes: h.Removes,
-			}
-			fc.Hunks = append(fc.Hunks, hc)
-			catalog.TotalHunks++
-		}
-		catalog.Files = append(catalog.Files, fc)
+// cliError turns what the CLI printed about a failed call into an error.
+// Failed API calls become an HTTPError, so that they are retried like those
+// of the HTTP backends.
+func cliError(err error, output string) error {
+	output = strings.TrimSpace(output)
+	if m := apiErrorRe.FindStringSubmatch(output); m != nil {
+		code, _ := strconv.Atoi(m[1])
+		return &HTTPError{Provider: "claude", StatusCode: code, Status: strings.TrimSpace(fmt.Sprintf("%d %s", code, http.StatusText(code))), Message: output}
 	}
-	return catalog
-}
-
-type FileInfo struct {
-	Path      string
-	IsNew     bool
-	IsDeleted bool
-	Hunks     []HunkInfo
+	if err == nil {
+		return fmt.Errorf("claude: %s", output)
+	}
+	return fmt.Errorf("claude: %w\n%s", err, output)
 }
 
-type HunkInfo struct {
-	Start   int
-	Count   int
-	Header  string
-	Adds    int
-	Removes int
+type claudeUsage struct {
+	InputTokens              int `json:"input_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
 }
 
-func parseAnalysisResponse(response string) (*SemanticAnalysis, error) {
-	response = strings.TrimSpace(response)
-	response = strings.TrimPrefix(response, "```json")
-	response = strings.TrimPrefix(response, "```")
-	response = strings.TrimSuffix(response, "```")
-	response = strings.TrimSpace(response)
-
-	var analysis SemanticAnalysis
-	if err := json.Unmarshal([]byte(response), &analysis); err != nil {
-		return nil, fmt.Errorf("failed to parse AI response: %w\nresponse was: %s", err, response)
+func (c *ClaudeCLI) recordUsage(result *claudeStreamEvent) {
+	model := c.Model
+	if full, ok := anthropicModelAliases[model]; ok {
+		model = full
 	}
-
-	return &analysis, nil
+	u := result.Usage
+	input := u.InputTokens + u.CacheCreationInputTokens + u.CacheReadInputTokens
+	c.record(model, input, u.OutputTokens, result.TotalCostUSD)
 }
 
-func (c *ClaudeCLI) GenerateDescription(ctx context.Context, diffText string) (string, error) {
-	prompt := fmt.Sprintf(`Describe this code change in 1-2 sentences. Be specific about what changed and why it matters.
-
-DIFF:
-%s
-
-Return only the description, no formatting.`, diffText)
+type claudeStreamEvent struct {
+	Type  string `json:"type"`
+	Event struct {
+		Type  string `json:"type"`
+		Delta struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		} `json:"delta"`
+	} `json:"event"`
+	Result       string      `json:"result"`
+	IsError      bool        `json:"is_error"`
+	Usage        claudeUsage `json:"usage"`
+	TotalCostUSD float64     `json:"total_cost_usd"`
+}
 
+func (c *ClaudeCLI) CompleteJSONStream(ctx context.Context, prompt string, onText func(string)) (string, error) {
 	ctx, cancel := context.WithTimeout(ctx, c.Timeout)
 	defer cancel()
 
-	cmd := exec.CommandContext(ctx, "claude", "--model", c.Model, "--print")
+	cmd := exec.CommandContext(ctx, "claude", "--model", c.Model, "--print",
+		"--output-format", "stream-json", "--verbose", "--include-partial-messages")
+	killOnCancel(cmd)
 	cmd.Stdin = strings.NewReader(prompt)
 
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
+	var stderr bytes.Buffer
 	cmd.Stderr = &stderr
 
-	if err := cmd.Run(); err != nil {
-		return "", fmt.Errorf("claude: %w\n%s", err, stderr.String())
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return "", err
+	}
+	if err := cmd.Start(); err != nil {
+		return "", fmt.Errorf("claude: %w", err)
+	}
+
+	var streamed strings.Builder
+	var result *claudeStreamEvent
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var event claudeStreamEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			continue
+		}
+		switch event.Type {
+		case "stream_event":
+			if event.Event.Type == "content_block_delta" && event.Event.Delta.Type == "text_delta" {
+				streamed.WriteString(event.Event.Delta.Text)
+				onText(event.Event.Delta.Text)
+			}
+		case "result":
+			result = &event
+		}
 	}
+	scanErr := scanner.Err()
+	io.Copy(io.Discard, stdout)
 
-	return strings.TrimSpace(stdout.String()), nil
+	if err := cmd.Wait(); err != nil {
+		if ctx.Err() != nil {
+			return "", fmt.Errorf("claude: %w", ctx.Err())
+		}
+		if result == nil || !result.IsError {
+			return "", cliError(err, stderr.String())
+		}
+	}
+	if scanErr != nil {
+		return "", fmt.Errorf("claude: %w", scanErr)
+	}
+	if result == nil {
+		return streamed.String(), nil
+	}
+	c.recordUsage(result)
+	if result.IsError {
+		return "", cliError(nil, result.Result)
+	}
+	return result.Result, nil
 }
@@ -0,0 +1,221 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	DefaultRetries     = 2
+	DefaultBackoff     = time.Second
+	DefaultMaxBackoff  = 8 * time.Second
+	DefaultCallTimeout = 120 * time.Second
+)
+
+type HTTPError struct {
+	Provider   string
+	StatusCode int
+	Status     string
+	Message    string
+}
+
+func (e *HTTPError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("%s: %s", e.Provider, e.Status)
+	}
+	return fmt.Sprintf("%s: %s: %s", e.Provider, e.Status, e.Message)
+}
+
+// IsTransient reports whether err is worth retrying with the same model:
+// rate limits, overloaded or unavailable servers, and dropped or timed out
+// connections. A call that ran into its own deadline is not retried.
+func IsTransient(err error) bool {
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		switch httpErr.StatusCode {
+		case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+			http.StatusServiceUnavailable, http.StatusGatewayTimeout, 529:
+			return true
+		}
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return false
+	}
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+type FallbackEvent struct {
+	Model    string
+	Reason   string
+	Attempts int
+}
+
+type ModelReporter interface {
+	ActiveModel() string
+	Fallbacks() []FallbackEvent
+}
+
+type RetryPolicy struct {
+	Retries    int
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+// Fallback tries each model in turn, retrying transient failures with
+// exponential backoff before moving on to the next one.
+type Fallback struct {
+	Policy RetryPolicy
+
+	models     []string
+	completers []Completer
+
+	mu        sync.Mutex
+	active    int
+	fallbacks []FallbackEvent
+}
+
+func NewFallback(models []string, completers []Completer, policy RetryPolicy) *Fallback {
+	return &Fallback{Policy: policy, models: models, completers: completers}
+}
+
+func (f *Fallback) Complete(ctx context.Context, prompt string) (string, error) {
+	return f.run(ctx, func(ctx context.Context, c Completer) (string, error) {
+		return c.Complete(ctx, prompt)
+	})
+}
+
+func (f *Fallback) CompleteJSON(ctx context.Context, prompt string) (string, error) {
+	return f.run(ctx, func(ctx context.Context, c Completer) (string, error) {
+		if jc, ok := c.(JSONCompleter); ok {
+			return jc.CompleteJSON(ctx, prompt)
+		}
+		return c.Complete(ctx, prompt)
+	})
+}
+
+// CompleteJSONStream streams from the first attempt only. Once text has
+// been passed to onText, later attempts run without streaming so the
+// caller never sees two responses interleaved.
+func (f *Fallback) CompleteJSONStream(ctx context.Context, prompt string, onText func(string)) (string, error) {
+	streamed := false
+	return f.run(ctx, func(ctx context.Context, c Completer) (string, error) {
+		sc, ok := c.(StreamCompleter)
+		if !ok || streamed {
+			if jc, ok := c.(JSONCompleter); ok {
+				return jc.CompleteJSON(ctx, prompt)
+			}
+			return c.Complete(ctx, prompt)
+		}
+		return sc.CompleteJSONStream(ctx, prompt, func(text string) {
+			streamed = true
+			onText(text)
+		})
+	})
+}
+
+func (f *Fallback) run(ctx context.Context, call func(ctx context.Context, c Completer) (string, error)) (string, error) {
+	f.mu.Lock()
+	start := f.active
+	f.mu.Unlock()
+
+	var lastErr error
+	for i := start; i < len(f.completers); i++ {
+		response, attempts, err := f.attempt(ctx, f.completers[i], call)
+		if err == nil {
+			return response, nil
+		}
+		if ctx.Err() != nil {
+			return "", err
+		}
+		lastErr = err
+
+		if i+1 < len(f.completers) {
+			f.mu.Lock()
+			if f.active == i {
+				f.active = i + 1
+				f.fallbacks = append(f.fallbacks, FallbackEvent{Model: f.models[i], Reason: err.Error(), Attempts: attempts})
+			}
+			f.mu.Unlock()
+		}
+	}
+	return "", lastErr
+}
+
+func (f *Fallback) attempt(ctx context.Context, c Completer, call func(ctx context.Context, c Completer) (string, error)) (string, int, error) {
+	backoff := f.Policy.Backoff
+	if backoff <= 0 {
+		backoff = DefaultBackoff
+	}
+	maxBackoff := f.Policy.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = DefaultMaxBackoff
+	}
+
+	for attempt := 1; ; attempt++ {
+		response, err := call(ctx, c)
+		if err == nil || ctx.Err() != nil || !IsTransient(err) || attempt > f.Policy.Retries {
+			return response, attempt, err
+		}
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return "", attempt, ctx.Err()
+		}
+		backoff = min(backoff*2, maxBackoff)
+	}
+}
+
+func (f *Fallback) ActiveModel() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.models[f.active]
+}
+
+func (f *Fallback) Fallbacks() []FallbackEvent {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]FallbackEvent(nil), f.fallbacks...)
+}
+
+// Usage adds up the usage of every model that was called.
+func (f *Fallback) Usage() Usage {
+	var total Usage
+	var models []string
+	for _, u := range f.ModelUsage() {
+		total.Calls += u.Calls
+		total.InputTokens += u.InputTokens
+		total.OutputTokens += u.OutputTokens
+		total.CostUSD += u.CostUSD
+		models = append(models, u.Model)
+	}
+	total.Model = strings.Join(models, ", ")
+	return total
+}
+
+// ModelUsage returns the usage of each model that was called, in the order
+// they were tried.
+func (f *Fallback) ModelUsage() []Usage {
+	var usage []Usage
+	for _, c := range f.completers {
+		if r, ok := c.(UsageReporter); ok {
+			if u := r.Usage(); u.Calls > 0 {
+				usage = append(usage, u)
+			}
+		}
+	}
+	return usage
+}
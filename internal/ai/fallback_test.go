@@ -0,0 +1,223 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"reflect"
+	"syscall"
+	"testing"
+	"time"
+)
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestIsTransient(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "rate limited", err: &HTTPError{StatusCode: 429}, want: true},
+		{name: "server error", err: &HTTPError{StatusCode: 500}, want: true},
+		{name: "bad gateway", err: &HTTPError{StatusCode: 502}, want: true},
+		{name: "unavailable", err: &HTTPError{StatusCode: 503}, want: true},
+		{name: "gateway timeout", err: &HTTPError{StatusCode: 504}, want: true},
+		{name: "overloaded", err: &HTTPError{StatusCode: 529}, want: true},
+		{name: "wrapped", err: fmt.Errorf("group: %w", &HTTPError{StatusCode: 503}), want: true},
+		{name: "bad request", err: &HTTPError{StatusCode: 400}},
+		{name: "unauthorized", err: &HTTPError{StatusCode: 401}},
+		{name: "not found", err: &HTTPError{StatusCode: 404}},
+		{name: "connection reset", err: &net.OpError{Op: "read", Err: os.NewSyscallError("read", syscall.ECONNRESET)}, want: true},
+		{name: "connection refused", err: &url.Error{Op: "Post", Err: &net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}}, want: true},
+		{name: "cut off response", err: fmt.Errorf("anthropic: %w", io.ErrUnexpectedEOF), want: true},
+		{name: "network timeout", err: &url.Error{Op: "Post", Err: timeoutError{}}, want: true},
+		{name: "own deadline", err: &url.Error{Op: "Post", Err: context.DeadlineExceeded}},
+		{name: "cancelled", err: context.Canceled},
+		{name: "other", err: errors.New("claude: not logged in")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsTransient(tt.err); got != tt.want {
+				t.Errorf("IsTransient(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+// scripted returns a completer that fails with errs in turn and then
+// answers, and counts its calls in *calls.
+func scripted(calls *int, errs ...error) Completer {
+	return completerFunc(func(ctx context.Context, prompt string) (string, error) {
+		*calls++
+		if *calls <= len(errs) {
+			return "", errs[*calls-1]
+		}
+		return fmt.Sprintf("answer %d", *calls), nil
+	})
+}
+
+func TestFallback(t *testing.T) {
+	overloaded := &HTTPError{Provider: "anthropic", StatusCode: 529, Status: "529"}
+	denied := &HTTPError{Provider: "anthropic", StatusCode: 403, Status: "403 Forbidden"}
+
+	tests := []struct {
+		name          string
+		a, b          []error
+		want          string
+		wantErr       error
+		wantCalls     [2]int
+		wantActive    string
+		wantFallbacks []FallbackEvent
+	}{
+		{
+			name:       "first model answers",
+			want:       "answer 1",
+			wantCalls:  [2]int{1, 0},
+			wantActive: "sonnet",
+		},
+		{
+			name:       "transient errors are retried",
+			a:          []error{overloaded, overloaded},
+			want:       "answer 3",
+			wantCalls:  [2]int{3, 0},
+			wantActive: "sonnet",
+		},
+		{
+			name:          "falls back once the retries run out",
+			a:             []error{overloaded, overloaded, overloaded},
+			want:          "answer 1",
+			wantCalls:     [2]int{3, 1},
+			wantActive:    "haiku",
+			wantFallbacks: []FallbackEvent{{Model: "sonnet", Reason: overloaded.Error(), Attempts: 3}},
+		},
+		{
+			name:          "other errors fall back at once",
+			a:             []error{denied},
+			want:          "answer 1",
+			wantCalls:     [2]int{1, 1},
+			wantActive:    "haiku",
+			wantFallbacks: []FallbackEvent{{Model: "sonnet", Reason: denied.Error(), Attempts: 1}},
+		},
+		{
+			name:          "every model fails",
+			a:             []error{denied},
+			b:             []error{overloaded, denied},
+			wantErr:       denied,
+			wantCalls:     [2]int{1, 2},
+			wantActive:    "haiku",
+			wantFallbacks: []FallbackEvent{{Model: "sonnet", Reason: denied.Error(), Attempts: 1}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls [2]int
+			f := NewFallback([]string{"sonnet", "haiku"}, []Completer{scripted(&calls[0], tt.a...), scripted(&calls[1], tt.b...)},
+				RetryPolicy{Retries: 2, Backoff: time.Millisecond})
+
+			got, err := f.Complete(context.Background(), "prompt")
+			if err != tt.wantErr {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Complete = %q, want %q", got, tt.want)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("calls = %v, want %v", calls, tt.wantCalls)
+			}
+			if f.ActiveModel() != tt.wantActive {
+				t.Errorf("ActiveModel = %q, want %q", f.ActiveModel(), tt.wantActive)
+			}
+			if !reflect.DeepEqual(f.Fallbacks(), tt.wantFallbacks) {
+				t.Errorf("Fallbacks = %+v, want %+v", f.Fallbacks(), tt.wantFallbacks)
+			}
+		})
+	}
+}
+
+func TestFallbackSticks(t *testing.T) {
+	var calls [2]int
+	f := NewFallback([]string{"sonnet", "haiku"}, []Completer{
+		scripted(&calls[0], errors.New("not logged in")),
+		scripted(&calls[1]),
+	}, RetryPolicy{})
+
+	for i := 0; i < 3; i++ {
+		if _, err := f.Complete(context.Background(), "prompt"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if want := [2]int{1, 3}; calls != want {
+		t.Errorf("calls = %v, want %v: later calls should start at the model that worked", calls, want)
+	}
+	if len(f.Fallbacks()) != 1 {
+		t.Errorf("Fallbacks = %+v, want one", f.Fallbacks())
+	}
+}
+
+func TestFallbackBackoff(t *testing.T) {
+	var times []time.Time
+	overloaded := &HTTPError{StatusCode: 529}
+	f := NewFallback([]string{"sonnet"}, []Completer{completerFunc(func(ctx context.Context, prompt string) (string, error) {
+		times = append(times, time.Now())
+		return "", overloaded
+	})}, RetryPolicy{Retries: 3, Backoff: 10 * time.Millisecond, MaxBackoff: 25 * time.Millisecond})
+
+	if _, err := f.Complete(context.Background(), "prompt"); err != overloaded {
+		t.Fatalf("err = %v, want %v", err, overloaded)
+	}
+	if len(times) != 4 {
+		t.Fatalf("%d attempts, want 4", len(times))
+	}
+	// The waits double from Backoff up to MaxBackoff.
+	for i, want := range []time.Duration{10, 20, 25} {
+		if wait := times[i+1].Sub(times[i]); wait < want*time.Millisecond {
+			t.Errorf("wait %d = %s, want at least %dms", i+1, wait, want)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	f.Policy = RetryPolicy{Retries: 5, Backoff: time.Hour}
+	start := time.Now()
+	if _, err := f.Complete(ctx, "prompt"); err != context.DeadlineExceeded {
+		t.Errorf("err = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("the backoff ignored the context for %s", d)
+	}
+}
+
+func TestRecorderReportsModels(t *testing.T) {
+	var calls [2]int
+	f := NewFallback([]string{"sonnet", "haiku"}, []Completer{
+		scripted(&calls[0], errors.New("not logged in")),
+		scripted(&calls[1]),
+	}, RetryPolicy{})
+	rec, err := NewRecorder(f, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewClient(rec)
+	if _, err := c.completeJSON(context.Background(), "prompt"); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := c.ActiveModel(); got != "haiku" {
+		t.Errorf("ActiveModel = %q, want haiku", got)
+	}
+	want := []FallbackEvent{{Model: "sonnet", Reason: "not logged in", Attempts: 1}}
+	if got := c.Fallbacks(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Fallbacks = %+v, want %+v", got, want)
+	}
+}
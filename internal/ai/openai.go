@@ -0,0 +1,241 @@
+package ai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const DefaultOpenAIBaseURL = "http://localhost:8080/v1"
+
+type OpenAICompatible struct {
+	Model      string
+	APIKey     string
+	BaseURL    string
+	JSONMode   bool
+	Timeout    time.Duration
+	HTTPClient *http.Client
+
+	usageMeter
+}
+
+func NewOpenAICompatible(model, apiKey, baseURL string, jsonMode bool) (*OpenAICompatible, error) {
+	if model == "" {
+		return nil, fmt.Errorf("openai: no model configured (set openai.model in config or pass --model)")
+	}
+	if apiKey == "" {
+		apiKey = os.Getenv("OPENAI_API_KEY")
+	}
+	if baseURL == "" {
+		baseURL = os.Getenv("OPENAI_BASE_URL")
+	}
+	if baseURL == "" {
+		baseURL = DefaultOpenAIBaseURL
+	}
+	return &OpenAICompatible{
+		Model:      model,
+		APIKey:     apiKey,
+		BaseURL:    strings.TrimSuffix(baseURL, "/"),
+		JSONMode:   jsonMode,
+		Timeout:    120 * time.Second,
+		HTTPClient: http.DefaultClient,
+	}, nil
+}
+
+type openAIMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type openAIResponseFormat struct {
+	Type string `json:"type"`
+}
+
+type openAIRequest struct {
+	Model          string                `json:"model"`
+	Messages       []openAIMessage       `json:"messages"`
+	ResponseFormat *openAIResponseFormat `json:"response_format,omitempty"`
+	Stream         bool                  `json:"stream,omitempty"`
+	StreamOptions  *openAIStreamOptions  `json:"stream_options,omitempty"`
+}
+
+type openAIStreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+type openAIUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+}
+
+type openAIError struct {
+	Message string `json:"message"`
+}
+
+type openAIResponse struct {
+	Choices []struct {
+		Message struct {
+			Content string `json:"content"`
+		} `json:"message"`
+		FinishReason string `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *openAIUsage `json:"usage"`
+	Error *openAIError `json:"error"`
+}
+
+type openAIStreamChunk struct {
+	Choices []struct {
+		Delta struct {
+			Content string `json:"content"`
+		} `json:"delta"`
+		FinishReason string `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *openAIUsage `json:"usage"`
+	Error *openAIError `json:"error"`
+}
+
+func (o *OpenAICompatible) recordUsage(u *openAIUsage) {
+	if u == nil {
+		o.record(o.Model, 0, 0, -1)
+		return
+	}
+	o.record(o.Model, u.PromptTokens, u.CompletionTokens, -1)
+}
+
+func (o *OpenAICompatible) Complete(ctx context.Context, prompt string) (string, error) {
+	return o.complete(ctx, prompt, false)
+}
+
+func (o *OpenAICompatible) CompleteJSON(ctx context.Context, prompt string) (string, error) {
+	return o.complete(ctx, prompt, o.JSONMode)
+}
+
+func (o *OpenAICompatible) complete(ctx context.Context, prompt string, jsonMode bool) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, o.Timeout)
+	defer cancel()
+
+	resp, err := o.post(ctx, prompt, jsonMode, false)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("openai: %w", err)
+	}
+
+	var parsed openAIResponse
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		return "", fmt.Errorf("openai: %s: %s", resp.Status, data)
+	}
+	o.recordUsage(parsed.Usage)
+	if len(parsed.Choices) == 0 {
+		return "", fmt.Errorf("openai: response contained no choices")
+	}
+
+	choice := parsed.Choices[0]
+	if choice.FinishReason == "length" {
+		return "", fmt.Errorf("openai: response truncated by the model's length limit")
+	}
+	return choice.Message.Content, nil
+}
+
+func (o *OpenAICompatible) CompleteJSONStream(ctx context.Context, prompt string, onText func(string)) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, o.Timeout)
+	defer cancel()
+
+	resp, err := o.post(ctx, prompt, o.JSONMode, true)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var sb strings.Builder
+	var finishReason string
+	var usage *openAIUsage
+	err = readSSE(resp.Body, func(data string) error {
+		if data == "[DONE]" {
+			return nil
+		}
+		var chunk openAIStreamChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return nil
+		}
+		if chunk.Error != nil {
+			return fmt.Errorf("openai: %s", chunk.Error.Message)
+		}
+		if chunk.Usage != nil {
+			usage = chunk.Usage
+		}
+		for _, choice := range chunk.Choices {
+			if choice.Delta.Content != "" {
+				sb.WriteString(choice.Delta.Content)
+				onText(choice.Delta.Content)
+			}
+			if choice.FinishReason != "" {
+				finishReason = choice.FinishReason
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	o.recordUsage(usage)
+	if finishReason == "length" {
+		return "", fmt.Errorf("openai: response truncated by the model's length limit")
+	}
+	return sb.String(), nil
+}
+
+func (o *OpenAICompatible) post(ctx context.Context, prompt string, jsonMode, stream bool) (*http.Response, error) {
+	reqBody := openAIRequest{
+		Model:    o.Model,
+		Messages: []openAIMessage{{Role: "user", Content: prompt}},
+		Stream:   stream,
+	}
+	if stream {
+		reqBody.StreamOptions = &openAIStreamOptions{IncludeUsage: true}
+	}
+	if jsonMode {
+		reqBody.ResponseFormat = &openAIResponseFormat{Type: "json_object"}
+	}
+
+	body, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, o.BaseURL+"/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if o.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+o.APIKey)
+	}
+
+	resp, err := o.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("openai: %w", err)
+	}
+	if resp.StatusCode == http.StatusOK {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+
+	data, _ := io.ReadAll(resp.Body)
+	var parsed openAIResponse
+	httpErr := &HTTPError{Provider: "openai", StatusCode: resp.StatusCode, Status: resp.Status}
+	if err := json.Unmarshal(data, &parsed); err == nil && parsed.Error != nil {
+		httpErr.Message = parsed.Error.Message
+	}
+	return nil, httpErr
+}
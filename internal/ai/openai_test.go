@@ -0,0 +1,303 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// openAIServer records each chat completion request in *got and answers
+// it with handler.
+func openAIServer(t *testing.T, jsonMode bool, got *openAIRequest, handler func(w http.ResponseWriter)) *OpenAICompatible {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" {
+			t.Errorf("path = %s, want /v1/chat/completions", r.URL.Path)
+		}
+		if auth := r.Header.Get("Authorization"); auth != "Bearer key" {
+			t.Errorf("Authorization = %q, want Bearer key", auth)
+		}
+		*got = openAIRequest{}
+		if err := json.NewDecoder(r.Body).Decode(got); err != nil {
+			t.Errorf("request body: %v", err)
+		}
+		handler(w)
+	}))
+	t.Cleanup(srv.Close)
+
+	o, err := NewOpenAICompatible("local-model", "key", srv.URL+"/v1/", jsonMode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return o
+}
+
+func TestOpenAIResponseFormat(t *testing.T) {
+	const body = `{"choices": [{"message": {"content": "{}"}, "finish_reason": "stop"}]}`
+	jsonObject := &openAIResponseFormat{Type: "json_object"}
+
+	tests := []struct {
+		name     string
+		jsonMode bool
+		call     func(o *OpenAICompatible) (string, error)
+		want     *openAIResponseFormat
+	}{
+		{name: "Complete", jsonMode: true, call: func(o *OpenAICompatible) (string, error) {
+			return o.Complete(context.Background(), "prompt")
+		}},
+		{name: "CompleteJSON", jsonMode: true, want: jsonObject, call: func(o *OpenAICompatible) (string, error) {
+			return o.CompleteJSON(context.Background(), "prompt")
+		}},
+		{name: "CompleteJSON without JSON mode", call: func(o *OpenAICompatible) (string, error) {
+			return o.CompleteJSON(context.Background(), "prompt")
+		}},
+		{name: "CompleteJSONStream", jsonMode: true, want: jsonObject, call: func(o *OpenAICompatible) (string, error) {
+			return o.CompleteJSONStream(context.Background(), "prompt", func(string) {})
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var req openAIRequest
+			o := openAIServer(t, tt.jsonMode, &req, func(w http.ResponseWriter) {
+				fmt.Fprint(w, body)
+			})
+			if _, err := tt.call(o); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(req.ResponseFormat, tt.want) {
+				t.Errorf("response_format = %+v, want %+v", req.ResponseFormat, tt.want)
+			}
+			want := []openAIMessage{{Role: "user", Content: "prompt"}}
+			if req.Model != "local-model" || !reflect.DeepEqual(req.Messages, want) {
+				t.Errorf("request = %+v", req)
+			}
+		})
+	}
+}
+
+func TestOpenAIComplete(t *testing.T) {
+	tests := []struct {
+		name      string
+		body      string
+		want      string
+		wantErr   string
+		wantUsage Usage
+	}{
+		{
+			name:      "answer",
+			body:      `{"choices": [{"message": {"content": "hello"}, "finish_reason": "stop"}], "usage": {"prompt_tokens": 12, "completion_tokens": 4}}`,
+			want:      "hello",
+			wantUsage: Usage{Model: "local-model", Calls: 1, InputTokens: 12, OutputTokens: 4},
+		},
+		{
+			name:      "no usage reported",
+			body:      `{"choices": [{"message": {"content": "hello"}}]}`,
+			want:      "hello",
+			wantUsage: Usage{Model: "local-model", Calls: 1},
+		},
+		{
+			name:      "truncated",
+			body:      `{"choices": [{"message": {"content": "{"}, "finish_reason": "length"}]}`,
+			wantErr:   "truncated",
+			wantUsage: Usage{Model: "local-model", Calls: 1},
+		},
+		{
+			name:      "no choices",
+			body:      `{"choices": []}`,
+			wantErr:   "no choices",
+			wantUsage: Usage{Model: "local-model", Calls: 1},
+		},
+		{
+			name:    "not JSON",
+			body:    `<html>`,
+			wantErr: "openai: 200 OK: <html>",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var req openAIRequest
+			o := openAIServer(t, false, &req, func(w http.ResponseWriter) {
+				fmt.Fprint(w, tt.body)
+			})
+			got, err := o.Complete(context.Background(), "prompt")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("Complete = %q, want %q", got, tt.want)
+			}
+			if u := o.Usage(); u != tt.wantUsage {
+				t.Errorf("Usage = %+v, want %+v", u, tt.wantUsage)
+			}
+		})
+	}
+}
+
+func TestOpenAIStream(t *testing.T) {
+	tests := []struct {
+		name      string
+		chunks    []string
+		want      string
+		wantText  []string
+		wantErr   string
+		wantUsage Usage
+	}{
+		{
+			name: "deltas",
+			chunks: []string{
+				`{"choices": [{"delta": {"role": "assistant"}}]}`,
+				`{"choices": [{"delta": {"content": "{\"groups\""}}]}`,
+				`not json`,
+				`{"choices": [{"delta": {"content": ": []}"}, "finish_reason": "stop"}]}`,
+				`{"choices": [], "usage": {"prompt_tokens": 30, "completion_tokens": 6}}`,
+				`[DONE]`,
+			},
+			want:      `{"groups": []}`,
+			wantText:  []string{`{"groups"`, `: []}`},
+			wantUsage: Usage{Model: "local-model", Calls: 1, InputTokens: 30, OutputTokens: 6},
+		},
+		{
+			name: "error mid-stream",
+			chunks: []string{
+				`{"choices": [{"delta": {"content": "{"}}]}`,
+				`{"error": {"message": "model crashed"}}`,
+			},
+			wantText: []string{"{"},
+			wantErr:  "openai: model crashed",
+		},
+		{
+			name: "truncated",
+			chunks: []string{
+				`{"choices": [{"delta": {"content": "{"}, "finish_reason": "length"}]}`,
+				`[DONE]`,
+			},
+			wantText:  []string{"{"},
+			wantErr:   "truncated",
+			wantUsage: Usage{Model: "local-model", Calls: 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var req openAIRequest
+			o := openAIServer(t, false, &req, func(w http.ResponseWriter) {
+				w.Header().Set("content-type", "text/event-stream")
+				for _, c := range tt.chunks {
+					fmt.Fprintf(w, "data: %s\n\n", c)
+				}
+			})
+
+			var text []string
+			got, err := o.CompleteJSONStream(context.Background(), "prompt", func(s string) {
+				text = append(text, s)
+			})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if !req.Stream || req.StreamOptions == nil || !req.StreamOptions.IncludeUsage {
+				t.Errorf("request = %+v, want a stream that includes usage", req)
+			}
+			if got != tt.want {
+				t.Errorf("CompleteJSONStream = %q, want %q", got, tt.want)
+			}
+			if !reflect.DeepEqual(text, tt.wantText) {
+				t.Errorf("streamed %q, want %q", text, tt.wantText)
+			}
+			if u := o.Usage(); u != tt.wantUsage {
+				t.Errorf("Usage = %+v, want %+v", u, tt.wantUsage)
+			}
+		})
+	}
+}
+
+func TestOpenAIHTTPErrors(t *testing.T) {
+	tests := []struct {
+		status        int
+		body          string
+		wantMessage   string
+		wantTransient bool
+	}{
+		{status: http.StatusTooManyRequests, body: `{"error": {"message": "rate limited"}}`, wantMessage: "rate limited", wantTransient: true},
+		{status: http.StatusBadGateway, wantTransient: true},
+		{status: http.StatusBadRequest, body: `{"error": {"message": "context length exceeded"}}`, wantMessage: "context length exceeded"},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.status), func(t *testing.T) {
+			var req openAIRequest
+			o := openAIServer(t, false, &req, func(w http.ResponseWriter) {
+				w.WriteHeader(tt.status)
+				fmt.Fprint(w, tt.body)
+			})
+			_, err := o.Complete(context.Background(), "prompt")
+			httpErr, ok := err.(*HTTPError)
+			if !ok {
+				t.Fatalf("err = %T %v, want *HTTPError", err, err)
+			}
+			if httpErr.Provider != "openai" || httpErr.StatusCode != tt.status || httpErr.Message != tt.wantMessage {
+				t.Errorf("err = %+v, want status %d and message %q", httpErr, tt.status, tt.wantMessage)
+			}
+			if IsTransient(err) != tt.wantTransient {
+				t.Errorf("IsTransient = %v, want %v", !tt.wantTransient, tt.wantTransient)
+			}
+		})
+	}
+}
+
+func TestNewOpenAICompatible(t *testing.T) {
+	tests := []struct {
+		name             string
+		env              map[string]string
+		apiKey, baseURL  string
+		wantKey, wantURL string
+	}{
+		{name: "defaults", wantURL: DefaultOpenAIBaseURL},
+		{
+			name:    "environment",
+			env:     map[string]string{"OPENAI_API_KEY": "env-key", "OPENAI_BASE_URL": "https://api.example.com/v1/"},
+			wantKey: "env-key",
+			wantURL: "https://api.example.com/v1",
+		},
+		{
+			name:    "explicit settings win",
+			env:     map[string]string{"OPENAI_API_KEY": "env-key", "OPENAI_BASE_URL": "https://api.example.com/v1"},
+			apiKey:  "key",
+			baseURL: "http://localhost:1234/v1",
+			wantKey: "key",
+			wantURL: "http://localhost:1234/v1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("OPENAI_API_KEY", tt.env["OPENAI_API_KEY"])
+			t.Setenv("OPENAI_BASE_URL", tt.env["OPENAI_BASE_URL"])
+			o, err := NewOpenAICompatible("local-model", tt.apiKey, tt.baseURL, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if o.APIKey != tt.wantKey || o.BaseURL != tt.wantURL {
+				t.Errorf("got key %q and base URL %q, want %q and %q", o.APIKey, o.BaseURL, tt.wantKey, tt.wantURL)
+			}
+		})
+	}
+
+	if _, err := NewOpenAICompatible("", "key", "", false); err == nil {
+		t.Error("no error without a model")
+	}
+}
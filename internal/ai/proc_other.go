@@ -0,0 +1,12 @@
+//go:build !unix
+
+package ai
+
+import (
+	"os/exec"
+	"time"
+)
+
+func killOnCancel(cmd *exec.Cmd) {
+	cmd.WaitDelay = 2 * time.Second
+}
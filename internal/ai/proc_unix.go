@@ -0,0 +1,19 @@
+//go:build unix
+
+package ai
+
+import (
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// killOnCancel runs cmd in its own process group and kills the whole group
+// when the context is cancelled, so helpers the CLI spawned don't outlive it.
+func killOnCancel(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	cmd.WaitDelay = 2 * time.Second
+}
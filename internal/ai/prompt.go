@@ -0,0 +1,340 @@
+package ai
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+type SemanticGroup struct {
+	ID          string          `json:"id,omitempty"`
+	Title       string          `json:"title"`
+	Description string          `json:"description"`
+	FileIndices []int           `json:"file_indices"`
+	HunkIndices [][]int         `json:"hunk_indices"`
+	Children    []SemanticGroup `json:"children,omitempty"`
+	DependsOn   []string        `json:"depends_on,omitempty"`
+	Review
+}
+
+// Review is how sure the model is of a group and what it thinks a reviewer
+// should check. A confidence of 0 means the model gave none.
+type Review struct {
+	Confidence float64  `json:"confidence,omitempty"`
+	Concerns   []string `json:"concerns,omitempty"`
+}
+
+// Merge carries the review of a group merged into this one over: the lowest
+// confidence wins and all concerns are kept.
+func (r *Review) Merge(o Review) {
+	if o.Confidence > 0 && (r.Confidence == 0 || o.Confidence < r.Confidence) {
+		r.Confidence = o.Confidence
+	}
+	r.Concerns = append(r.Concerns, o.Concerns...)
+}
+
+func (g *SemanticGroup) Leaves() []SemanticGroup {
+	if len(g.Children) == 0 {
+		return []SemanticGroup{*g}
+	}
+	var leaves []SemanticGroup
+	for i := range g.Children {
+		leaves = append(leaves, g.Children[i].Leaves()...)
+	}
+	return leaves
+}
+
+type SemanticAnalysis struct {
+	Groups []SemanticGroup `json:"groups"`
+	Usage  *Usage          `json:"usage,omitempty"`
+	// MergeErr is set when the batches of a large diff could not be merged
+	// and Groups holds the groups of each batch instead.
+	MergeErr error `json:"-"`
+}
+
+type DiffCatalog struct {
+	Files      []FileCatalog
+	TotalHunks int
+}
+
+type FileCatalog struct {
+	Index      int
+	Path       string
+	DiffHeader string
+	IsNew      bool
+	IsDelete   bool
+	Parents    int
+	Hunks      []HunkCatalog
+}
+
+type HunkCatalog struct {
+	Index   int
+	Start   int
+	End     int
+	Header  string
+	Adds    int
+	Removes int
+	Text    string
+	Context string
+}
+
+func buildAnalysisPrompt(catalog *DiffCatalog, rawDiff string) string {
+	var sb strings.Builder
+
+	sb.WriteString("# Diff Catalog\n\n")
+	for _, f := range catalog.Files {
+		status := ""
+		if f.IsNew {
+			status = " (new file)"
+		} else if f.IsDelete {
+			status = " (deleted)"
+		} else if f.Parents > 0 {
+			status = fmt.Sprintf(" (merge of %d parents)", f.Parents)
+		}
+		sb.WriteString(fmt.Sprintf("File[%d]: %s%s\n", f.Index, f.Path, status))
+		for _, h := range f.Hunks {
+			header := ""
+			if h.Header != "" {
+				header = fmt.Sprintf(" // %s", h.Header)
+			}
+			sb.WriteString(fmt.Sprintf("  Hunk[%d]: lines %d-%d (+%d/-%d)%s\n",
+				h.Index, h.Start, h.End, h.Adds, h.Removes, header))
+		}
+	}
+
+	return fmt.Sprintf(`%s
+# Diff Content
+
+%s
+%s
+# Instructions
+
+Group these hunks into logical changes. Return ONLY valid JSON.
+
+RULES:
+%s- Hunks from the same file should be in the same group unless they do completely different things
+- Each hunk must appear in EXACTLY ONE group (no duplicates)
+- You MUST specify explicit hunk_indices for every file - never omit them
+- Title should be imperative mood, <60 chars
+- Give every group a short unique id, and list in depends_on the ids of the groups a reader should understand first (e.g. the data model change before the handler that uses it)
+- List the groups in the order a reviewer should read them, so every group comes after the groups it depends on
+- Set confidence between 0 and 1 for how sure you are that the title and description are right; use a low value when you are guessing the intent
+- List in concerns anything a reviewer should look at closely, e.g. "behavior change in error path" or "removed validation"; leave it empty when there is nothing
+
+JSON format:
+{
+  "groups": [
+    {
+      "id": "auth",
+      "title": "Add user authentication",
+      "description": "One sentence explaining what and why",
+      "file_indices": [0, 1],
+      "hunk_indices": [[0, 1], [0]],
+      "depends_on": [],
+      "confidence": 0.9,
+      "concerns": ["login no longer fails closed when the token store is unreachable"]
+    }%s
+  ]
+}
+
+file_indices: which files (by index)
+hunk_indices: REQUIRED - for each file in file_indices, list its hunk indices
+depends_on: ids of groups this group builds on; only reference groups at the same level
+confidence: 0 to 1
+concerns: short phrases, [] when there are none
+
+Return ONLY JSON, no markdown fences.`, sb.String(), rawDiff, enclosingCode(catalog)+mergeResolution(catalog), groupRules(catalog), nestedExample(catalog))
+}
+
+func enclosingCode(catalog *DiffCatalog) string {
+	var sb strings.Builder
+	for _, f := range catalog.Files {
+		for _, h := range f.Hunks {
+			if h.Context != "" {
+				fmt.Fprintf(&sb, "\nFile[%d] Hunk[%d] is inside %s", f.Index, h.Index, h.Context)
+			}
+		}
+	}
+	if sb.Len() == 0 {
+		return ""
+	}
+	return `
+# Enclosing Code
+
+The full function or type around some hunks, from the new version of each file, with line numbers. Lines marked ">" were added or changed by the hunk; all other lines are unchanged context. Removed lines only appear in the diff above.
+` + sb.String()
+}
+
+func mergeResolution(catalog *DiffCatalog) string {
+	parents := 0
+	for _, f := range catalog.Files {
+		parents = max(parents, f.Parents)
+	}
+	if parents == 0 {
+		return ""
+	}
+	return fmt.Sprintf(`
+# Merge Resolution
+
+This is a merge commit. Files marked as a merge are shown as combined diffs: each line starts with %d marker columns, one per parent. A "+" in column N means the line is in the merge result but not in parent N, and a "-" means the line was in parent N but was dropped by the merge. A line without markers is the same in all parents and the result. These are the places where the merge did more than take one side, usually conflict resolutions.
+
+In each description say what the merge resolution kept, dropped or rewrote compared with each parent, e.g. "keeps the retry loop from parent 1 and the new timeout from parent 2". Mention in concerns any change that is in neither parent.
+`, parents)
+}
+
+const nestMinFiles = 6
+
+func maxGroupsFor(catalog *DiffCatalog) int {
+	files := len(catalog.Files)
+	return min(files+1, 4+files/8)
+}
+
+func maxSubGroupsFor(catalog *DiffCatalog) int {
+	return min(catalog.TotalHunks, 3*maxGroupsFor(catalog))
+}
+
+func allowNesting(catalog *DiffCatalog) bool {
+	return len(catalog.Files) >= nestMinFiles
+}
+
+func groupRules(catalog *DiffCatalog) string {
+	if !allowNesting(catalog) {
+		return fmt.Sprintf("- Create AT MOST %d groups (fewer is better, 1-2 is ideal)\n", maxGroupsFor(catalog))
+	}
+	return fmt.Sprintf(`- Create AT MOST %d top-level groups (fewer is better)
+- A top-level group MAY be a theme that holds sub-groups in "children", e.g. "Add OAuth login" with sub-groups for handlers, storage and tests. Only do this when the theme has clearly separable parts
+- A theme has no file_indices or hunk_indices of its own; each of its hunks belongs to exactly one sub-group
+- Sub-groups cannot have children of their own, and there are AT MOST %d sub-groups in total
+`, maxGroupsFor(catalog), maxSubGroupsFor(catalog))
+}
+
+func nestedExample(catalog *DiffCatalog) string {
+	if !allowNesting(catalog) {
+		return ""
+	}
+	return `,
+    {
+      "id": "oauth",
+      "title": "Add OAuth login",
+      "description": "One sentence explaining the theme",
+      "depends_on": ["auth"],
+      "children": [
+        {
+          "id": "oauth-handler",
+          "title": "Add OAuth callback handler",
+          "description": "One sentence explaining what and why",
+          "file_indices": [2],
+          "hunk_indices": [[0, 1]]
+        },
+        {
+          "id": "oauth-tests",
+          "title": "Test the login flow",
+          "description": "One sentence explaining what and why",
+          "file_indices": [3],
+          "hunk_indices": [[0]],
+          "depends_on": ["oauth-handler"]
+        }
+      ]
+    }`
+}
+
+func BuildCatalog(files []FileInfo) *DiffCatalog {
+	catalog := &DiffCatalog{}
+	for i, f := range files {
+		fc := FileCatalog{
+			Index:      i,
+			Path:       f.Path,
+			DiffHeader: f.DiffHeader,
+			IsNew:      f.IsNew,
+			IsDelete:   f.IsDeleted,
+			Parents:    f.Parents,
+		}
+		for j, h := range f.Hunks {
+			hc := HunkCatalog{
+				Index:   j,
+				Start:   h.Start,
+				End:     h.Start + h.Count,
+				Header:  h.Header,
+				Adds:    h.Adds,
+				Removes: h.Removes,
+				Text:    h.Text,
+				Context: h.Context,
+			}
+			fc.Hunks = append(fc.Hunks, hc)
+			catalog.TotalHunks++
+		}
+		catalog.Files = append(catalog.Files, fc)
+	}
+	return catalog
+}
+
+type FileInfo struct {
+	Path       string
+	DiffHeader string
+	IsNew      bool
+	IsDeleted  bool
+	Parents    int
+	Hunks      []HunkInfo
+}
+
+type HunkInfo struct {
+	Start   int
+	Count   int
+	Header  string
+	Adds    int
+	Removes int
+	Text    string
+	Context string
+}
+
+func buildDescriptionPrompt(diffText string) string {
+	merge := ""
+	if strings.HasPrefix(diffText, "diff --cc ") {
+		merge = " This is a combined diff of a merge commit with one marker column per parent; say what the merge resolution kept, dropped or rewrote compared with each parent."
+	}
+	return fmt.Sprintf(`Describe this code change in 1-2 sentences. Be specific about what changed and why it matters.%s
+
+DIFF:
+%s
+
+Return only the description, no formatting.`, merge, diffText)
+}
+
+func buildQuestionPrompt(diffText string, history []Exchange, question string) string {
+	var sb strings.Builder
+	sb.WriteString(`You are helping a developer review a group of related changes from a git diff. Answer their question about these changes concisely and concretely, referring to the code where it helps. If the diff does not contain enough information to answer, say so.
+
+DIFF:
+`)
+	sb.WriteString(diffText)
+	sb.WriteString("\n")
+
+	if len(history) > 0 {
+		sb.WriteString("\nEARLIER QUESTIONS AND ANSWERS:\n")
+		for _, ex := range history {
+			fmt.Fprintf(&sb, "\nQ: %s\nA: %s\n", ex.Question, ex.Answer)
+		}
+	}
+
+	fmt.Fprintf(&sb, "\nQUESTION: %s\n\nAnswer in plain text without markdown headings.", question)
+	return sb.String()
+}
+
+func trimFences(response string) string {
+	response = strings.TrimSpace(response)
+	response = strings.TrimPrefix(response, "```json")
+	response = strings.TrimPrefix(response, "```")
+	response = strings.TrimSuffix(response, "```")
+	return strings.TrimSpace(response)
+}
+
+func parseAnalysisResponse(response string) (*SemanticAnalysis, error) {
+	response = trimFences(response)
+
+	var analysis SemanticAnalysis
+	if err := json.Unmarshal([]byte(response), &analysis); err != nil {
+		return nil, fmt.Errorf("failed to parse AI response: %w\nresponse was: %s", err, response)
+	}
+
+	return &analysis, nil
+}
@@ -0,0 +1,172 @@
+package ai
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FixtureEnv selects a recording or replaying backend, as "record:<dir>"
+// or "replay:<dir>".
+const FixtureEnv = "HNK_AI"
+
+type fixture struct {
+	Prompt   string `json:"prompt"`
+	Response string `json:"response"`
+}
+
+func PromptHash(prompt string) string {
+	h := sha256.Sum256([]byte(prompt))
+	return hex.EncodeToString(h[:16])
+}
+
+func fixturePath(dir, prompt string) string {
+	return filepath.Join(dir, PromptHash(prompt)+".json")
+}
+
+type Recorder struct {
+	Dir   string
+	inner Completer
+}
+
+func NewRecorder(inner Completer, dir string) (*Recorder, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("record: %w", err)
+	}
+	return &Recorder{Dir: dir, inner: inner}, nil
+}
+
+func (r *Recorder) Complete(ctx context.Context, prompt string) (string, error) {
+	response, err := r.inner.Complete(ctx, prompt)
+	if err != nil {
+		return "", err
+	}
+	return response, r.save(prompt, response)
+}
+
+func (r *Recorder) CompleteJSON(ctx context.Context, prompt string) (string, error) {
+	jc, ok := r.inner.(JSONCompleter)
+	if !ok {
+		return r.Complete(ctx, prompt)
+	}
+	response, err := jc.CompleteJSON(ctx, prompt)
+	if err != nil {
+		return "", err
+	}
+	return response, r.save(prompt, response)
+}
+
+func (r *Recorder) CompleteJSONStream(ctx context.Context, prompt string, onText func(string)) (string, error) {
+	sc, ok := r.inner.(StreamCompleter)
+	if !ok {
+		response, err := r.CompleteJSON(ctx, prompt)
+		if err != nil {
+			return "", err
+		}
+		onText(response)
+		return response, nil
+	}
+	response, err := sc.CompleteJSONStream(ctx, prompt, onText)
+	if err != nil {
+		return "", err
+	}
+	return response, r.save(prompt, response)
+}
+
+func (r *Recorder) Usage() Usage {
+	if ur, ok := r.inner.(UsageReporter); ok {
+		return ur.Usage()
+	}
+	return Usage{}
+}
+
+func (r *Recorder) ModelUsage() []Usage {
+	if mr, ok := r.inner.(ModelUsageReporter); ok {
+		return mr.ModelUsage()
+	}
+	return nil
+}
+
+func (r *Recorder) ActiveModel() string {
+	if mr, ok := r.inner.(ModelReporter); ok {
+		return mr.ActiveModel()
+	}
+	return ""
+}
+
+func (r *Recorder) Fallbacks() []FallbackEvent {
+	if mr, ok := r.inner.(ModelReporter); ok {
+		return mr.Fallbacks()
+	}
+	return nil
+}
+
+func (r *Recorder) save(prompt, response string) error {
+	data, err := json.MarshalIndent(fixture{Prompt: prompt, Response: response}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(fixturePath(r.Dir, prompt), append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("record: %w", err)
+	}
+	return nil
+}
+
+type Replay struct {
+	Dir string
+}
+
+func NewReplay(dir string) *Replay {
+	return &Replay{Dir: dir}
+}
+
+func (r *Replay) Complete(ctx context.Context, prompt string) (string, error) {
+	path := fixturePath(r.Dir, prompt)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("replay: no recorded response for prompt %s in %s", PromptHash(prompt), r.Dir)
+	}
+	if err != nil {
+		return "", fmt.Errorf("replay: %w", err)
+	}
+
+	var f fixture
+	if err := json.Unmarshal(data, &f); err != nil {
+		return "", fmt.Errorf("replay: %s: %w", path, err)
+	}
+	return f.Response, nil
+}
+
+func (r *Replay) CompleteJSONStream(ctx context.Context, prompt string, onText func(string)) (string, error) {
+	response, err := r.Complete(ctx, prompt)
+	if err != nil {
+		return "", err
+	}
+	onText(response)
+	return response, nil
+}
+
+func fixtureCompleter(setting string, opts Options) (Completer, error) {
+	mode, dir, ok := strings.Cut(setting, ":")
+	if !ok || dir == "" {
+		return nil, fmt.Errorf("%s must be record:<dir> or replay:<dir>, got %q", FixtureEnv, setting)
+	}
+	switch mode {
+	case "replay":
+		return NewReplay(dir), nil
+	case "record":
+		inner, err := newBackend(opts)
+		if err != nil {
+			return nil, err
+		}
+		return NewRecorder(inner, dir)
+	default:
+		return nil, fmt.Errorf("%s must be record:<dir> or replay:<dir>, got %q", FixtureEnv, setting)
+	}
+}
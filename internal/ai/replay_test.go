@@ -0,0 +1,166 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// completerFunc is a Completer that answers with a function.
+type completerFunc func(ctx context.Context, prompt string) (string, error)
+
+func (f completerFunc) Complete(ctx context.Context, prompt string) (string, error) {
+	return f(ctx, prompt)
+}
+
+func writeFixture(t *testing.T, dir, name, content string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	dir := t.TempDir()
+	writeFixture(t, dir, PromptHash("hello")+".json", `{"prompt": "hello", "response": "world"}`)
+	writeFixture(t, dir, PromptHash("broken")+".json", `{"prompt": `)
+
+	tests := []struct {
+		name    string
+		prompt  string
+		want    string
+		wantErr string
+	}{
+		{name: "recorded prompt", prompt: "hello", want: "world"},
+		{name: "keyed by the exact prompt", prompt: "hello ", wantErr: "no recorded response for prompt " + PromptHash("hello ")},
+		{name: "missing fixture", prompt: "other", wantErr: "no recorded response for prompt " + PromptHash("other") + " in " + dir},
+		{name: "malformed fixture", prompt: "broken", wantErr: "replay: " + filepath.Join(dir, PromptHash("broken")+".json")},
+	}
+
+	r := NewReplay(dir)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := r.Complete(context.Background(), tt.prompt)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("Complete = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPromptHash(t *testing.T) {
+	if PromptHash("a") == PromptHash("b") {
+		t.Error("different prompts share a hash")
+	}
+	if got := PromptHash("a"); got != PromptHash("a") || len(got) != 32 {
+		t.Errorf("PromptHash = %q, want 32 stable hex digits", got)
+	}
+}
+
+func TestRecordThenReplay(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "fixtures")
+	inner := completerFunc(func(ctx context.Context, prompt string) (string, error) {
+		if prompt == "fail" {
+			return "", errors.New("backend down")
+		}
+		return "answer to " + prompt, nil
+	})
+	rec, err := NewRecorder(inner, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	calls := []struct {
+		name   string
+		prompt string
+		call   func(prompt string) (string, error)
+	}{
+		{name: "Complete", prompt: "one", call: func(p string) (string, error) { return rec.Complete(ctx, p) }},
+		{name: "CompleteJSON", prompt: "two", call: func(p string) (string, error) { return rec.CompleteJSON(ctx, p) }},
+		{name: "CompleteJSONStream", prompt: "three", call: func(p string) (string, error) {
+			var streamed string
+			response, err := rec.CompleteJSONStream(ctx, p, func(text string) { streamed += text })
+			if streamed != response {
+				t.Errorf("streamed %q, but returned %q", streamed, response)
+			}
+			return response, err
+		}},
+	}
+
+	replay := NewReplay(dir)
+	for _, c := range calls {
+		t.Run(c.name, func(t *testing.T) {
+			recorded, err := c.call(c.prompt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := "answer to " + c.prompt; recorded != want {
+				t.Errorf("recorded %q, want %q", recorded, want)
+			}
+			if _, err := os.Stat(fixturePath(dir, c.prompt)); err != nil {
+				t.Errorf("no fixture for %q: %v", c.prompt, err)
+			}
+			replayed, err := replay.Complete(ctx, c.prompt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if replayed != recorded {
+				t.Errorf("replayed %q, want %q", replayed, recorded)
+			}
+		})
+	}
+
+	if _, err := rec.Complete(ctx, "fail"); err == nil {
+		t.Fatal("the backend's error was not passed on")
+	}
+	if _, err := os.Stat(fixturePath(dir, "fail")); !os.IsNotExist(err) {
+		t.Errorf("a failed call was recorded: %v", err)
+	}
+}
+
+func TestFixtureCompleter(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		setting string
+		want    string
+		wantErr bool
+	}{
+		{setting: "replay:" + dir, want: "*ai.Replay"},
+		{setting: "record:" + dir, want: "*ai.Recorder"},
+		{setting: "replay:", wantErr: true},
+		{setting: "replay", wantErr: true},
+		{setting: "play:" + dir, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.setting, func(t *testing.T) {
+			c, err := fixtureCompleter(tt.setting, Options{Provider: DefaultProvider})
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), FixtureEnv) {
+					t.Fatalf("err = %v, want an error naming %s", err, FixtureEnv)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := fmt.Sprintf("%T", c); got != tt.want {
+				t.Errorf("completer is %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
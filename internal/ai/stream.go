@@ -0,0 +1,161 @@
+package ai
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+type StreamCompleter interface {
+	CompleteJSONStream(ctx context.Context, prompt string, onText func(string)) (string, error)
+}
+
+// StreamAnalyzer passes groups to onGroup as the model produces them. When
+// the final, validated analysis does not start with the groups already
+// passed on, because the response was corrected or came from another
+// attempt, onReset is called and every group of the final analysis follows.
+type StreamAnalyzer interface {
+	AnalyzeDiffStream(ctx context.Context, catalog *DiffCatalog, rawDiff string, onGroup func(SemanticGroup), onReset func()) (*SemanticAnalysis, error)
+}
+
+func (c *Client) AnalyzeDiffStream(ctx context.Context, catalog *DiffCatalog, rawDiff string, onGroup func(SemanticGroup), onReset func()) (*SemanticAnalysis, error) {
+	prompt := buildAnalysisPrompt(catalog, rawDiff)
+
+	sc, ok := c.completer.(StreamCompleter)
+	if !ok || c.exceedsBudget(catalog, prompt) {
+		analysis, err := c.AnalyzeDiff(ctx, catalog, rawDiff)
+		if err != nil {
+			return nil, err
+		}
+		for _, g := range analysis.Groups {
+			onGroup(g)
+		}
+		return analysis, nil
+	}
+
+	// A streamed group is passed on once it passes the checks that don't
+	// need the rest of the response. After the first group that fails,
+	// nothing more is passed on until the whole response is valid.
+	parser := &groupStream{}
+	v := newValidator(catalog)
+	var shown []SemanticGroup
+	valid := true
+	response, err := sc.CompleteJSONStream(ctx, prompt, func(delta string) {
+		for _, g := range parser.Write(delta) {
+			if valid = valid && v.check(&g, len(shown)); valid {
+				shown = append(shown, g)
+				onGroup(g)
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	analysis, err := c.validateResponse(ctx, catalog, prompt, response)
+	if err != nil {
+		return nil, err
+	}
+
+	if !startsWith(analysis.Groups, shown) {
+		onReset()
+		shown = nil
+	}
+	for _, g := range analysis.Groups[len(shown):] {
+		onGroup(g)
+	}
+	return analysis, nil
+}
+
+func startsWith(groups, prefix []SemanticGroup) bool {
+	return len(prefix) <= len(groups) && slices.EqualFunc(groups[:len(prefix)], prefix, func(a, b SemanticGroup) bool {
+		return reflect.DeepEqual(a, b)
+	})
+}
+
+type groupStream struct {
+	buf     strings.Builder
+	pos     int
+	inArray bool
+	done    bool
+	depth   int
+	inStr   bool
+	escaped bool
+	start   int
+}
+
+func (s *groupStream) Write(delta string) []SemanticGroup {
+	s.buf.WriteString(delta)
+	text := s.buf.String()
+
+	if !s.inArray {
+		key := strings.Index(text, `"groups"`)
+		if key < 0 {
+			return nil
+		}
+		open := strings.Index(text[key:], "[")
+		if open < 0 {
+			return nil
+		}
+		s.inArray = true
+		s.pos = key + open + 1
+	}
+
+	var groups []SemanticGroup
+	for ; s.pos < len(text) && !s.done; s.pos++ {
+		ch := text[s.pos]
+		if s.inStr {
+			switch {
+			case s.escaped:
+				s.escaped = false
+			case ch == '\\':
+				s.escaped = true
+			case ch == '"':
+				s.inStr = false
+			}
+			continue
+		}
+
+		switch ch {
+		case '"':
+			s.inStr = true
+		case ']':
+			if s.depth == 0 {
+				s.done = true
+			}
+		case '{':
+			if s.depth == 0 {
+				s.start = s.pos
+			}
+			s.depth++
+		case '}':
+			s.depth--
+			if s.depth == 0 {
+				var g SemanticGroup
+				if err := json.Unmarshal([]byte(text[s.start:s.pos+1]), &g); err == nil {
+					groups = append(groups, g)
+				}
+			}
+		}
+	}
+	return groups
+}
+
+func readSSE(r io.Reader, onData func(data string) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		data, ok := strings.CutPrefix(line, "data:")
+		if !ok {
+			continue
+		}
+		if err := onData(strings.TrimSpace(data)); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
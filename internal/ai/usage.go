@@ -0,0 +1,104 @@
+package ai
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+type Usage struct {
+	Model        string  `json:"model,omitempty"`
+	Calls        int     `json:"calls"`
+	InputTokens  int     `json:"input_tokens"`
+	OutputTokens int     `json:"output_tokens"`
+	CostUSD      float64 `json:"cost_usd"`
+}
+
+type UsageReporter interface {
+	Usage() Usage
+}
+
+// ModelUsageReporter is implemented by backends that may call more than
+// one model, to report the usage of each separately.
+type ModelUsageReporter interface {
+	ModelUsage() []Usage
+}
+
+func (u Usage) Sub(o Usage) Usage {
+	return Usage{
+		Model:        u.Model,
+		Calls:        u.Calls - o.Calls,
+		InputTokens:  u.InputTokens - o.InputTokens,
+		OutputTokens: u.OutputTokens - o.OutputTokens,
+		CostUSD:      u.CostUSD - o.CostUSD,
+	}
+}
+
+func (u Usage) String() string {
+	calls := "calls"
+	if u.Calls == 1 {
+		calls = "call"
+	}
+	s := fmt.Sprintf("%d %s, %d input + %d output tokens, ~$%.4f", u.Calls, calls, u.InputTokens, u.OutputTokens, u.CostUSD)
+	if u.Model != "" {
+		s += " (" + u.Model + ")"
+	}
+	return s
+}
+
+type usageMeter struct {
+	mu    sync.Mutex
+	total Usage
+}
+
+func (m *usageMeter) Usage() Usage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.total
+}
+
+// record adds one call to the running total. A negative cost means the
+// backend did not report one, so it is estimated from the price table.
+func (m *usageMeter) record(model string, input, output int, cost float64) {
+	if cost < 0 {
+		cost = EstimateCost(model, input, output)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.total.Model = model
+	m.total.Calls++
+	m.total.InputTokens += input
+	m.total.OutputTokens += output
+	m.total.CostUSD += cost
+}
+
+// USD per million input and output tokens, matched by model id prefix in
+// order, so longer prefixes come first.
+var modelPrices = []struct {
+	prefix        string
+	input, output float64
+}{
+	{"claude-opus-4-5", 5, 25},
+	{"claude-opus-4", 15, 75},
+	{"claude-3-opus", 15, 75},
+	{"claude-sonnet-4", 3, 15},
+	{"claude-3-7-sonnet", 3, 15},
+	{"claude-3-5-sonnet", 3, 15},
+	{"claude-haiku-4-5", 1, 5},
+	{"claude-3-5-haiku", 0.8, 4},
+	{"claude-3-haiku", 0.25, 1.25},
+}
+
+// EstimateCost prices a call by its model id. Aliases like "sonnet" are
+// priced as the model they stand for; unknown models cost nothing.
+func EstimateCost(model string, input, output int) float64 {
+	if id, ok := anthropicModelAliases[model]; ok {
+		model = id
+	}
+	for _, p := range modelPrices {
+		if strings.HasPrefix(model, p.prefix) {
+			return (float64(input)*p.input + float64(output)*p.output) / 1e6
+		}
+	}
+	return 0
+}
@@ -0,0 +1,155 @@
+package ai
+
+import (
+	"fmt"
+	"strings"
+)
+
+const DefaultMaxRetries = 2
+
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid AI response: " + strings.Join(e.Problems, "; ")
+}
+
+func ValidateAnalysis(catalog *DiffCatalog, analysis *SemanticAnalysis) []string {
+	if len(analysis.Groups) == 0 {
+		return []string{"the response contains no groups"}
+	}
+
+	v := newValidator(catalog)
+	v.dependencies(analysis.Groups, "")
+	for gi := range analysis.Groups {
+		v.group(&analysis.Groups[gi], fmt.Sprint(gi), 0)
+	}
+
+	for _, f := range catalog.Files {
+		for _, h := range f.Hunks {
+			if _, ok := v.seen[[2]int{f.Index, h.Index}]; !ok {
+				v.problems = append(v.problems, fmt.Sprintf("File[%d] Hunk[%d] (%s) is not assigned to any group", f.Index, h.Index, f.Path))
+			}
+		}
+	}
+
+	return v.problems
+}
+
+type validator struct {
+	catalog  *DiffCatalog
+	seen     map[[2]int]string
+	problems []string
+}
+
+func newValidator(catalog *DiffCatalog) *validator {
+	return &validator{catalog: catalog, seen: make(map[[2]int]string)}
+}
+
+// check validates one top-level group on its own, as far as that is
+// possible before the rest of the response is known.
+func (v *validator) check(g *SemanticGroup, index int) bool {
+	before := len(v.problems)
+	v.group(g, fmt.Sprint(index), 0)
+	return len(v.problems) == before
+}
+
+func (v *validator) group(g *SemanticGroup, label string, depth int) {
+	if strings.TrimSpace(g.Title) == "" {
+		v.problems = append(v.problems, fmt.Sprintf("group %s has an empty title", label))
+	}
+	if g.Confidence < 0 || g.Confidence > 1 {
+		v.problems = append(v.problems, fmt.Sprintf("group %s has confidence %g; it must be between 0 and 1", label, g.Confidence))
+	}
+
+	if len(g.Children) > 0 {
+		if depth > 0 {
+			v.problems = append(v.problems, fmt.Sprintf("group %s has children, but sub-groups cannot be nested further", label))
+		}
+		if len(g.FileIndices) > 0 || len(g.HunkIndices) > 0 {
+			v.problems = append(v.problems, fmt.Sprintf("group %s has both children and its own hunks; move its hunks into a sub-group", label))
+		}
+		v.dependencies(g.Children, label+".")
+		for ci := range g.Children {
+			v.group(&g.Children[ci], fmt.Sprintf("%s.%d", label, ci), depth+1)
+		}
+		return
+	}
+
+	if len(g.FileIndices) != len(g.HunkIndices) {
+		v.problems = append(v.problems, fmt.Sprintf("group %s has %d file_indices but %d hunk_indices entries; they must have the same length",
+			label, len(g.FileIndices), len(g.HunkIndices)))
+	}
+
+	for i, fileIdx := range g.FileIndices {
+		if fileIdx < 0 || fileIdx >= len(v.catalog.Files) {
+			v.problems = append(v.problems, fmt.Sprintf("group %s references File[%d], which does not exist", label, fileIdx))
+			continue
+		}
+		if i >= len(g.HunkIndices) {
+			continue
+		}
+		if len(g.HunkIndices[i]) == 0 {
+			v.problems = append(v.problems, fmt.Sprintf("group %s lists File[%d] with no hunk indices", label, fileIdx))
+		}
+
+		file := v.catalog.Files[fileIdx]
+		for _, hunkIdx := range g.HunkIndices[i] {
+			if hunkIdx < 0 || hunkIdx >= len(file.Hunks) {
+				v.problems = append(v.problems, fmt.Sprintf("group %s references File[%d] Hunk[%d], which does not exist (the file has %d hunks)",
+					label, fileIdx, hunkIdx, len(file.Hunks)))
+				continue
+			}
+			key := [2]int{fileIdx, hunkIdx}
+			if prev, ok := v.seen[key]; ok {
+				if prev == label {
+					v.problems = append(v.problems, fmt.Sprintf("File[%d] Hunk[%d] is listed twice in group %s", fileIdx, hunkIdx, label))
+				} else {
+					v.problems = append(v.problems, fmt.Sprintf("File[%d] Hunk[%d] appears in both group %s and group %s", fileIdx, hunkIdx, prev, label))
+				}
+				continue
+			}
+			v.seen[key] = label
+		}
+	}
+}
+
+func (v *validator) dependencies(groups []SemanticGroup, prefix string) {
+	ids := make(map[string]bool)
+	for _, g := range groups {
+		if g.ID != "" {
+			ids[g.ID] = true
+		}
+	}
+	for gi, g := range groups {
+		for _, dep := range g.DependsOn {
+			switch {
+			case dep == g.ID:
+				v.problems = append(v.problems, fmt.Sprintf("group %s%d depends on itself", prefix, gi))
+			case !ids[dep]:
+				v.problems = append(v.problems, fmt.Sprintf("group %s%d depends on %q, which is not the id of a group at the same level", prefix, gi, dep))
+			}
+		}
+	}
+}
+
+func buildCorrectionPrompt(prompt, response string, problems []string) string {
+	var sb strings.Builder
+	for _, p := range problems {
+		sb.WriteString("- " + p + "\n")
+	}
+
+	return fmt.Sprintf(`%s
+
+# Your Previous Response
+
+%s
+
+# Problems
+
+Your previous response was rejected because:
+
+%s
+Fix every problem listed above and return the complete corrected JSON. Return ONLY JSON, no markdown fences.`, prompt, strings.TrimSpace(response), sb.String())
+}
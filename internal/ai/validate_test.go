@@ -0,0 +1,126 @@
+package ai
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestValidateAnalysis(t *testing.T) {
+	catalog := &DiffCatalog{
+		Files: []FileCatalog{
+			{Index: 0, Path: "a.go", Hunks: []HunkCatalog{{Index: 0}, {Index: 1}}},
+			{Index: 1, Path: "b.go", Hunks: []HunkCatalog{{Index: 0}}},
+		},
+		TotalHunks: 3,
+	}
+
+	tests := []struct {
+		name   string
+		groups []SemanticGroup
+		want   []string
+	}{
+		{
+			name: "valid",
+			groups: []SemanticGroup{
+				{ID: "a", Title: "A", FileIndices: []int{0}, HunkIndices: [][]int{{0, 1}}, Review: Review{Confidence: 0.9}},
+				{ID: "b", Title: "B", FileIndices: []int{1}, HunkIndices: [][]int{{0}}, DependsOn: []string{"a"}},
+			},
+		},
+		{
+			name: "valid with children",
+			groups: []SemanticGroup{
+				{ID: "a", Title: "A", Children: []SemanticGroup{
+					{ID: "x", Title: "X", FileIndices: []int{0}, HunkIndices: [][]int{{0}}},
+					{ID: "y", Title: "Y", FileIndices: []int{0, 1}, HunkIndices: [][]int{{1}, {0}}, DependsOn: []string{"x"}},
+				}},
+			},
+		},
+		{
+			name: "no groups",
+			want: []string{"the response contains no groups"},
+		},
+		{
+			name: "empty title and bad confidence",
+			groups: []SemanticGroup{
+				{Title: " ", FileIndices: []int{0, 1}, HunkIndices: [][]int{{0, 1}, {0}}, Review: Review{Confidence: 1.5}},
+			},
+			want: []string{
+				"group 0 has an empty title",
+				"group 0 has confidence 1.5; it must be between 0 and 1",
+			},
+		},
+		{
+			name: "hunks that don't exist or are missing",
+			groups: []SemanticGroup{
+				{Title: "A", FileIndices: []int{0, 2}, HunkIndices: [][]int{{0, 5}, {0}}},
+				{Title: "B", FileIndices: []int{1}, HunkIndices: [][]int{{}}},
+			},
+			want: []string{
+				"group 0 references File[0] Hunk[5], which does not exist (the file has 2 hunks)",
+				"group 0 references File[2], which does not exist",
+				"group 1 lists File[1] with no hunk indices",
+				"File[0] Hunk[1] (a.go) is not assigned to any group",
+				"File[1] Hunk[0] (b.go) is not assigned to any group",
+			},
+		},
+		{
+			name: "mismatched indices",
+			groups: []SemanticGroup{
+				{Title: "A", FileIndices: []int{0, 1}, HunkIndices: [][]int{{0, 1}}},
+			},
+			want: []string{
+				"group 0 has 2 file_indices but 1 hunk_indices entries; they must have the same length",
+				"File[1] Hunk[0] (b.go) is not assigned to any group",
+			},
+		},
+		{
+			name: "hunks listed twice",
+			groups: []SemanticGroup{
+				{Title: "A", FileIndices: []int{0, 0}, HunkIndices: [][]int{{0}, {0, 1}}},
+				{Title: "B", FileIndices: []int{0, 1}, HunkIndices: [][]int{{1}, {0}}},
+			},
+			want: []string{
+				"File[0] Hunk[0] is listed twice in group 0",
+				"File[0] Hunk[1] appears in both group 0 and group 1",
+			},
+		},
+		{
+			name: "children with their own hunks or nested too deep",
+			groups: []SemanticGroup{
+				{Title: "A", FileIndices: []int{1}, HunkIndices: [][]int{{0}}, Children: []SemanticGroup{
+					{Title: "X", Children: []SemanticGroup{
+						{Title: "Deep", FileIndices: []int{0}, HunkIndices: [][]int{{0, 1}}},
+					}},
+				}},
+			},
+			want: []string{
+				"group 0 has both children and its own hunks; move its hunks into a sub-group",
+				"group 0.0 has children, but sub-groups cannot be nested further",
+				"File[1] Hunk[0] (b.go) is not assigned to any group",
+			},
+		},
+		{
+			name: "bad dependencies",
+			groups: []SemanticGroup{
+				{ID: "a", Title: "A", DependsOn: []string{"a"}, Children: []SemanticGroup{
+					{ID: "x", Title: "X", FileIndices: []int{0}, HunkIndices: [][]int{{0, 1}}, DependsOn: []string{"b"}},
+				}},
+				{ID: "b", Title: "B", FileIndices: []int{1}, HunkIndices: [][]int{{0}}, DependsOn: []string{"x"}},
+			},
+			want: []string{
+				"group 0 depends on itself",
+				`group 1 depends on "x", which is not the id of a group at the same level`,
+				`group 0.0 depends on "b", which is not the id of a group at the same level`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ValidateAnalysis(catalog, &SemanticAnalysis{Groups: tt.groups})
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("problems =\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
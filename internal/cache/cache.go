@@ -7,6 +7,7 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
+	"sync"
 	"time"
 )
 
@@ -21,6 +22,7 @@ type Cache struct {
 	Entries []Entry `json:"entries"`
 	path    string
 	maxSize int
+	mu      sync.Mutex
 }
 
 const DefaultMaxSize = 5 * 1024 * 1024 // 5MB
@@ -82,6 +84,8 @@ func HashKey(content string) string {
 }
 
 func (c *Cache) Get(key string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	for _, e := range c.Entries {
 		if e.Key == key {
 			return e.Value, true
@@ -91,6 +95,8 @@ func (c *Cache) Get(key string) (string, bool) {
 }
 
 func (c *Cache) Set(key, value string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	size := len(key) + len(value)
 
 	for i, e := range c.Entries {
@@ -128,11 +134,15 @@ func (c *Cache) evict() {
 }
 
 func (c *Cache) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	c.Entries = nil
 	c.save()
 }
 
 func (c *Cache) TotalSize() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	total := 0
 	for _, e := range c.Entries {
 		total += e.Size
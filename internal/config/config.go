@@ -4,23 +4,58 @@ import (
 	"encoding/json"
 	"os"
 	"path/filepath"
+	"time"
 )
 
 type Config struct {
 	Theme       string `json:"theme"`
 	Model       string `json:"model"`
+	Provider    string `json:"provider,omitempty"`
 	Style       string `json:"style"`
 	LineNumbers *bool  `json:"line_numbers,omitempty"`
+	SplitHunks  *bool  `json:"split_hunks,omitempty"`
+	Untracked   bool   `json:"untracked,omitempty"`
 	CacheSizeMB int    `json:"cache_size_mb,omitempty"`
+
+	MaxPromptTokens   int `json:"max_prompt_tokens,omitempty"`
+	ValidationRetries int `json:"validation_retries"`
+	Concurrency       int `json:"concurrency,omitempty"`
+
+	TimeoutSeconds    int      `json:"timeout_seconds,omitempty"`
+	GitTimeoutSeconds int      `json:"git_timeout_seconds,omitempty"`
+	Retries           int      `json:"retries"`
+	FallbackModels    []string `json:"fallback_models,omitempty"`
+
+	FunctionContext bool `json:"function_context,omitempty"`
+	ContextTokens   int  `json:"context_tokens,omitempty"`
+
+	Anthropic AnthropicConfig `json:"anthropic"`
+	OpenAI    OpenAIConfig    `json:"openai"`
+}
+
+type AnthropicConfig struct {
+	APIKey  string `json:"api_key,omitempty"`
+	BaseURL string `json:"base_url,omitempty"`
+}
+
+type OpenAIConfig struct {
+	BaseURL  string `json:"base_url,omitempty"`
+	APIKey   string `json:"api_key,omitempty"`
+	Model    string `json:"model,omitempty"`
+	JSONMode bool   `json:"json_mode,omitempty"`
 }
 
 func DefaultConfig() *Config {
 	return &Config{
 		Theme:       "auto",
 		Model:       "sonnet",
+		Provider:    "claude-cli",
 		Style:       "",
 		LineNumbers: nil,
 		CacheSizeMB: 5,
+
+		ValidationRetries: 2,
+		Retries:           2,
 	}
 }
 
@@ -91,6 +126,17 @@ func (c *Config) Save() error {
 	return os.WriteFile(path, data, 0644)
 }
 
+func (c *Config) Timeout() time.Duration {
+	return time.Duration(c.TimeoutSeconds) * time.Second
+}
+
+func (c *Config) GitTimeout() time.Duration {
+	if c.GitTimeoutSeconds <= 0 {
+		return 30 * time.Second
+	}
+	return time.Duration(c.GitTimeoutSeconds) * time.Second
+}
+
 func (c *Config) CacheSizeBytes() int {
 	if c.CacheSizeMB <= 0 {
 		return 5 * 1024 * 1024
@@ -0,0 +1,205 @@
+package diff
+
+import (
+	"strings"
+)
+
+func SplitAtoms(d *Diff) *Diff {
+	out := &Diff{Files: make([]FileDiff, len(d.Files))}
+	for i, f := range d.Files {
+		out.Files[i] = f
+		if f.IsNew || f.IsDeleted || f.IsBinary || f.Parents > 0 {
+			continue
+		}
+		var hunks []Hunk
+		for j := range f.Hunks {
+			hunks = append(hunks, f.Hunks[j].Atoms()...)
+		}
+		out.Files[i].Hunks = hunks
+	}
+	return out
+}
+
+func (h *Hunk) Atoms() []Hunk {
+	splits := h.splitPoints()
+	if len(splits) == 0 {
+		return []Hunk{*h}
+	}
+
+	var atoms []Hunk
+	start := 0
+	for _, end := range append(splits, len(h.Lines)) {
+		atoms = append(atoms, h.slice(start, end))
+		start = end
+	}
+	return atoms
+}
+
+func (h *Hunk) splitPoints() []int {
+	var points []int
+	lastChange := -1
+	for i, l := range h.Lines {
+		if l.Type == LineContext {
+			continue
+		}
+		if lastChange >= 0 && i-lastChange > 1 {
+			if p, ok := splitInGap(h.Lines, lastChange+1, i); ok {
+				points = append(points, p)
+			}
+		}
+		lastChange = i
+	}
+	return points
+}
+
+func splitInGap(lines []Line, start, end int) (int, bool) {
+	for i := start; i < end; i++ {
+		if isBoundary(lines[i].Content) {
+			return i, true
+		}
+	}
+	for i := end - 1; i >= start; i-- {
+		if strings.TrimSpace(lines[i].Content) == "" {
+			return i + 1, true
+		}
+	}
+	return 0, false
+}
+
+func isBoundary(content string) bool {
+	if content == "" || content[0] == ' ' || content[0] == '\t' {
+		return false
+	}
+	switch content[0] {
+	case '}', ')', ']', '*':
+		return false
+	}
+	return true
+}
+
+func (h *Hunk) slice(start, end int) Hunk {
+	oldNum, newNum := h.OldStart, h.NewStart
+	header := h.Header
+	for _, l := range h.Lines[:start] {
+		switch l.Type {
+		case LineContext:
+			oldNum++
+			newNum++
+		case LineRemoved:
+			oldNum++
+		case LineAdded:
+			newNum++
+		}
+		if l.Type != LineRemoved && isBoundary(l.Content) {
+			header = strings.TrimSpace(l.Content)
+		}
+	}
+
+	atom := Hunk{
+		OldStart: oldNum,
+		NewStart: newNum,
+		Header:   header,
+		Lines:    h.Lines[start:end:end],
+	}
+	for _, l := range atom.Lines {
+		switch l.Type {
+		case LineContext:
+			atom.OldCount++
+			atom.NewCount++
+		case LineRemoved:
+			atom.OldCount++
+		case LineAdded:
+			atom.NewCount++
+		}
+	}
+	if atom.OldCount == 0 {
+		atom.OldStart--
+	}
+	if atom.NewCount == 0 {
+		atom.NewStart--
+	}
+	atom.lead, atom.trail = h.padding(start, end)
+	return atom
+}
+
+// patchContext is the number of context lines git puts around a change.
+const patchContext = 3
+
+// padding returns the unchanged lines of h just before start and just after
+// end, as many as Lines[start:end] needs to have patchContext lines of
+// context on each side.
+func (h *Hunk) padding(start, end int) (lead, trail []Line) {
+	own := 0
+	for i := start; i < end && own < patchContext && h.Lines[i].Type == LineContext; i++ {
+		own++
+	}
+	from := start
+	for from > 0 && start-from < patchContext-own && h.Lines[from-1].Type == LineContext {
+		from--
+	}
+
+	own = 0
+	for i := end - 1; i >= start && own < patchContext && h.Lines[i].Type == LineContext; i-- {
+		own++
+	}
+	to := end
+	for to < len(h.Lines) && to-end < patchContext-own && h.Lines[to].Type == LineContext {
+		to++
+	}
+	return h.Lines[from:start:start], h.Lines[end:to:to]
+}
+
+// withContext returns h with the context lines that were cut off when it
+// was split into atoms, so it applies on its own.
+func (h *Hunk) withContext() *Hunk {
+	if len(h.lead) == 0 && len(h.trail) == 0 {
+		return h
+	}
+	padded := *h
+	padded.Lines = append(append(append([]Line(nil), h.lead...), h.Lines...), h.trail...)
+	if h.OldCount == 0 {
+		padded.OldStart++
+	}
+	if h.NewCount == 0 {
+		padded.NewStart++
+	}
+	padded.OldStart -= len(h.lead)
+	padded.NewStart -= len(h.lead)
+	padded.OldCount += len(h.lead) + len(h.trail)
+	padded.NewCount += len(h.lead) + len(h.trail)
+	padded.lead, padded.trail = nil, nil
+	return &padded
+}
+
+func Adjacent(a, b *Hunk) bool {
+	oldEnd, newEnd := a.OldStart+a.OldCount, a.NewStart+a.NewCount
+	if a.OldCount == 0 {
+		oldEnd++
+	}
+	if a.NewCount == 0 {
+		newEnd++
+	}
+	bOld, bNew := b.OldStart, b.NewStart
+	if b.OldCount == 0 {
+		bOld++
+	}
+	if b.NewCount == 0 {
+		bNew++
+	}
+	return oldEnd == bOld && newEnd == bNew
+}
+
+func Stitch(a, b *Hunk) Hunk {
+	merged := *a
+	merged.Lines = append(append([]Line(nil), a.Lines...), b.Lines...)
+	merged.trail = b.trail
+	merged.OldCount = a.OldCount + b.OldCount
+	merged.NewCount = a.NewCount + b.NewCount
+	if a.OldCount == 0 {
+		merged.OldStart = b.OldStart
+	}
+	if a.NewCount == 0 {
+		merged.NewStart = b.NewStart
+	}
+	return merged
+}
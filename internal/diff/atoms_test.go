@@ -0,0 +1,162 @@
+package diff
+
+import (
+	"testing"
+)
+
+const twoFuncs = `diff --git a/x.go b/x.go
+--- a/x.go
++++ b/x.go
+@@ -1,7 +1,7 @@
+ package x
+
+-func a() int { return 1 }
++func a() int { return 2 }
+
+ func b() int {
+-	return 1
++	return 2
+ }
+`
+
+var atomTests = []struct {
+	name  string
+	input string
+	want  []string
+}{
+	{
+		name:  "split at a declaration",
+		input: twoFuncs,
+		want: []string{
+			"@@ -1,4 +1,4 @@\n package x\n \n-func a() int { return 1 }\n+func a() int { return 2 }\n \n",
+			"@@ -5,3 +5,3 @@ func a() int { return 2 }\n func b() int {\n-\treturn 1\n+\treturn 2\n }\n",
+		},
+	},
+	{
+		name: "split after a blank line",
+		input: `diff --git a/f.go b/f.go
+--- a/f.go
++++ b/f.go
+@@ -1,5 +1,5 @@ func f() {
+-	a := 1
++	a := 2
+ 	log()
+
+ 	b := 1
+-	c := 1
++	c := 2
+`,
+		want: []string{
+			"@@ -1,3 +1,3 @@ func f() {\n-\ta := 1\n+\ta := 2\n \tlog()\n \n",
+			"@@ -4,2 +4,2 @@ func f() {\n \tb := 1\n-\tc := 1\n+\tc := 2\n",
+		},
+	},
+	{
+		name: "no place to split",
+		input: `diff --git a/f.go b/f.go
+--- a/f.go
++++ b/f.go
+@@ -1,3 +1,3 @@ func f() {
+-	a := 1
+ 	log()
++	c := 2
+`,
+		want: []string{
+			"@@ -1,3 +1,3 @@ func f() {\n-\ta := 1\n \tlog()\n+\tc := 2\n",
+		},
+	},
+	{
+		name: "new file",
+		input: `diff --git a/n.go b/n.go
+new file mode 100644
+--- /dev/null
++++ b/n.go
+@@ -0,0 +1,3 @@
++package n
++
++func n() {}
+`,
+		want: []string{
+			"@@ -0,0 +1,3 @@\n+package n\n+\n+func n() {}\n",
+		},
+	},
+}
+
+func TestSplitAtoms(t *testing.T) {
+	for _, tt := range atomTests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := mustParse(t, tt.input)
+			hunks := SplitAtoms(d).Files[0].Hunks
+			if len(hunks) != len(tt.want) {
+				t.Fatalf("got %d atoms, want %d", len(hunks), len(tt.want))
+			}
+			for i := range hunks {
+				if got := hunks[i].RawString(); got != tt.want[i] {
+					t.Errorf("atom %d =\n%s\nwant\n%s", i, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestStitch(t *testing.T) {
+	for _, tt := range atomTests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := mustParse(t, tt.input)
+			f := d.Files[0]
+			atoms := SplitAtoms(d).Files[0].Hunks
+
+			stitched := atoms[0]
+			for i := 1; i < len(atoms); i++ {
+				if !Adjacent(&stitched, &atoms[i]) {
+					t.Fatalf("atom %d is not adjacent to the ones before it", i)
+				}
+				stitched = Stitch(&stitched, &atoms[i])
+			}
+			if got, want := FormatPatch(&f, []*Hunk{&stitched}), FormatPatch(&f, []*Hunk{&f.Hunks[0]}); got != want {
+				t.Errorf("stitched patch =\n%s\nwant\n%s", got, want)
+			}
+		})
+	}
+}
+
+func TestFormatPatchAtomContext(t *testing.T) {
+	d := mustParse(t, twoFuncs)
+	f := d.Files[0]
+	atoms := SplitAtoms(d).Files[0].Hunks
+
+	tests := []struct {
+		name string
+		atom int
+		want string
+	}{
+		{
+			name: "first atom gets trailing context",
+			atom: 0,
+			want: "@@ -1,5 +1,5 @@\n package x\n \n-func a() int { return 1 }\n+func a() int { return 2 }\n \n func b() int {\n",
+		},
+		{
+			name: "second atom gets leading context",
+			atom: 1,
+			want: "@@ -4,4 +4,4 @@ func a() int { return 2 }\n \n func b() int {\n-\treturn 1\n+\treturn 2\n }\n",
+		},
+	}
+
+	header := "diff --git a/x.go b/x.go\n--- a/x.go\n+++ b/x.go\n"
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FormatPatch(&f, []*Hunk{&atoms[tt.atom]}); got != header+tt.want {
+				t.Errorf("FormatPatch =\n%s\nwant\n%s", got, header+tt.want)
+			}
+		})
+	}
+}
+
+func mustParse(t *testing.T, input string) *Diff {
+	t.Helper()
+	d, err := Parse(input)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	return d
+}
@@ -0,0 +1,103 @@
+package diff
+
+import (
+	"strconv"
+	"strings"
+)
+
+func parseCombinedHunkHeader(matches []string) *Hunk {
+	h := &Hunk{Header: strings.TrimSpace(matches[5])}
+	for _, field := range strings.Fields(matches[2]) {
+		h.Parents = append(h.Parents, parseRange(strings.TrimPrefix(field, "-")))
+	}
+	h.NewStart, _ = strconv.Atoi(matches[3])
+	h.NewCount = 1
+	if matches[4] != "" {
+		h.NewCount, _ = strconv.Atoi(matches[4])
+	}
+	h.OldStart, h.OldCount = h.Parents[0].Start, h.Parents[0].Count
+	return h
+}
+
+func parseRange(s string) Range {
+	start, count, ok := strings.Cut(s, ",")
+	r := Range{Count: 1}
+	r.Start, _ = strconv.Atoi(start)
+	if ok {
+		r.Count, _ = strconv.Atoi(count)
+	}
+	return r
+}
+
+// parseCombinedLine reads a combined diff line, which starts with one
+// column per parent: "+" when the result has the line and that parent
+// doesn't, "-" when that parent has it and the result doesn't. parentNums
+// tracks the next line number in each parent and is advanced. OldNum is the
+// line's number in the first parent that has it.
+func parseCombinedLine(line string, parentNums []int, newNum int) (Line, bool) {
+	n := len(parentNums)
+	if len(line) < n {
+		if strings.TrimSpace(line) != "" {
+			return Line{}, false
+		}
+		line += strings.Repeat(" ", n-len(line))
+	}
+	markers, content := line[:n], line[n:]
+	if strings.Trim(markers, "+- ") != "" {
+		return Line{}, false
+	}
+
+	l := Line{Content: content, Markers: markers}
+	switch {
+	case strings.Contains(markers, "-"):
+		l.Type = LineRemoved
+	case strings.Contains(markers, "+"):
+		l.Type = LineAdded
+		l.NewNum = newNum
+	default:
+		l.Type = LineContext
+		l.NewNum = newNum
+	}
+
+	for i, m := range markers {
+		inParent := m == ' '
+		if l.Type == LineRemoved {
+			inParent = m == '-'
+		}
+		if !inParent {
+			continue
+		}
+		if l.OldNum == 0 {
+			l.OldNum = parentNums[i]
+		}
+		parentNums[i]++
+	}
+	return l, true
+}
+
+func (h *Hunk) combinedRange() string {
+	var sb strings.Builder
+	at := strings.Repeat("@", len(h.Parents)+1)
+	sb.WriteString(at)
+	for _, r := range h.Parents {
+		sb.WriteString(" -" + strconv.Itoa(r.Start) + "," + strconv.Itoa(r.Count))
+	}
+	sb.WriteString(" +" + strconv.Itoa(h.NewStart) + "," + strconv.Itoa(h.NewCount) + " " + at)
+	return sb.String()
+}
+
+func (h *Hunk) combinedString() string {
+	var sb strings.Builder
+	sb.WriteString(h.combinedRange())
+	if h.Header != "" {
+		sb.WriteString(" " + h.Header)
+	}
+	sb.WriteString("\n")
+	for _, l := range h.Lines {
+		sb.WriteString(l.Prefix() + l.Content + "\n")
+		if l.NoNewline {
+			sb.WriteString("\\ No newline at end of file\n")
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,121 @@
+package diff
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseCombined(t *testing.T) {
+	tests := []struct {
+		name        string
+		input       string
+		wantParents []Range
+		wantNew     Range
+		wantHeader  string
+		wantLines   []Line
+	}{
+		{
+			name: "two parents",
+			input: `diff --cc a.go
+index 1111111,2222222..3333333
+--- a/a.go
++++ b/a.go
+@@@ -1,3 -1,3 +1,4 @@@ func f()
+  one
+- two
+ -deux
+++both
++ theirs
+  three
+`,
+			wantParents: []Range{{Start: 1, Count: 3}, {Start: 1, Count: 3}},
+			wantNew:     Range{Start: 1, Count: 4},
+			wantHeader:  "func f()",
+			wantLines: []Line{
+				{Type: LineContext, Content: "one", OldNum: 1, NewNum: 1, Markers: "  "},
+				{Type: LineRemoved, Content: "two", OldNum: 2, Markers: "- "},
+				{Type: LineRemoved, Content: "deux", OldNum: 2, Markers: " -"},
+				{Type: LineAdded, Content: "both", NewNum: 2, Markers: "++"},
+				{Type: LineAdded, Content: "theirs", OldNum: 3, NewNum: 3, Markers: "+ "},
+				{Type: LineContext, Content: "three", OldNum: 3, NewNum: 4, Markers: "  "},
+			},
+		},
+		{
+			name: "three parents",
+			input: `diff --combined b.go
+--- a/b.go
++++ b/b.go
+@@@@ -5 -5,2 -6,2 +5,2 @@@@
+   keep
+++ new
+`,
+			wantParents: []Range{{Start: 5, Count: 1}, {Start: 5, Count: 2}, {Start: 6, Count: 2}},
+			wantNew:     Range{Start: 5, Count: 2},
+			wantLines: []Line{
+				{Type: LineContext, Content: "keep", OldNum: 5, NewNum: 5, Markers: "   "},
+				{Type: LineAdded, Content: "new", OldNum: 7, NewNum: 6, Markers: "++ "},
+			},
+		},
+		{
+			name: "short blank line is context",
+			input: `diff --cc c.go
+--- a/c.go
++++ b/c.go
+@@@ -1,2 -1,2 +1,2 @@@
+
+  x
+`,
+			wantParents: []Range{{Start: 1, Count: 2}, {Start: 1, Count: 2}},
+			wantNew:     Range{Start: 1, Count: 2},
+			wantLines: []Line{
+				{Type: LineContext, Content: "", OldNum: 1, NewNum: 1, Markers: "  "},
+				{Type: LineContext, Content: "x", OldNum: 2, NewNum: 2, Markers: "  "},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := mustParse(t, tt.input)
+			if len(d.Files) != 1 || len(d.Files[0].Hunks) != 1 {
+				t.Fatalf("got %d files, want 1 with 1 hunk", len(d.Files))
+			}
+			f := d.Files[0]
+			if f.Parents != len(tt.wantParents) {
+				t.Errorf("Parents = %d, want %d", f.Parents, len(tt.wantParents))
+			}
+
+			h := f.Hunks[0]
+			if !reflect.DeepEqual(h.Parents, tt.wantParents) {
+				t.Errorf("hunk parents = %v, want %v", h.Parents, tt.wantParents)
+			}
+			if h.OldStart != tt.wantParents[0].Start || h.OldCount != tt.wantParents[0].Count {
+				t.Errorf("old range = %d,%d, want the first parent's", h.OldStart, h.OldCount)
+			}
+			if got := (Range{Start: h.NewStart, Count: h.NewCount}); got != tt.wantNew {
+				t.Errorf("new range = %v, want %v", got, tt.wantNew)
+			}
+			if h.Header != tt.wantHeader {
+				t.Errorf("Header = %q, want %q", h.Header, tt.wantHeader)
+			}
+			if !reflect.DeepEqual(h.Lines, tt.wantLines) {
+				t.Errorf("Lines =\n%+v\nwant\n%+v", h.Lines, tt.wantLines)
+			}
+		})
+	}
+}
+
+func TestCombinedRoundTrip(t *testing.T) {
+	input := `diff --cc a.go
+@@@ -1,3 -1,3 +1,4 @@@ func f()
+  one
+- two
+ -deux
+++both
+  three
+`
+	d := mustParse(t, input)
+	if got := d.RawString(); got != input {
+		t.Errorf("RawString =\n%s\nwant\n%s", got, input)
+	}
+}
@@ -17,10 +17,32 @@ const (
 )
 
 type Line struct {
-	Type    LineType
-	Content string
-	OldNum  int
-	NewNum  int
+	Type      LineType
+	Content   string
+	OldNum    int
+	NewNum    int
+	NoNewline bool
+	Stage     Stage
+	// Markers holds one column per parent in a combined diff.
+	Markers string
+}
+
+func (l *Line) Prefix() string {
+	if l.Markers != "" {
+		return l.Markers
+	}
+	switch l.Type {
+	case LineAdded:
+		return "+"
+	case LineRemoved:
+		return "-"
+	}
+	return " "
+}
+
+type Range struct {
+	Start int
+	Count int
 }
 
 type Hunk struct {
@@ -30,6 +52,12 @@ type Hunk struct {
 	NewCount int
 	Lines    []Line
 	Header   string
+	// Parents holds the range in each parent of a combined diff. OldStart
+	// and OldCount are the first parent's.
+	Parents []Range
+	// lead and trail are the unchanged lines around an atom in the hunk it
+	// was split from, which a patch of the atom needs as context.
+	lead, trail []Line
 }
 
 func (h *Hunk) Stats() (adds, removes int) {
@@ -51,8 +79,12 @@ type FileDiff struct {
 	IsDeleted bool
 	IsRenamed bool
 	IsBinary  bool
+	OldMode   string
+	NewMode   string
 	Language  string
 	Hunks     []Hunk
+	// Parents is the number of parents of a combined diff (diff --cc), or 0.
+	Parents int
 }
 
 type Diff struct {
@@ -64,6 +96,9 @@ var (
 	oldFileRe    = regexp.MustCompile(`^--- (?:a/)?(.+)$`)
 	newFileRe    = regexp.MustCompile(`^\+\+\+ (?:b/)?(.+)$`)
 	hunkHeaderRe = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@(.*)$`)
+
+	combinedHeaderRe     = regexp.MustCompile(`^diff --(?:cc|combined) (.+)$`)
+	combinedHunkHeaderRe = regexp.MustCompile(`^(@@@+) ((?:-\d+(?:,\d+)? )+)\+(\d+)(?:,(\d+))? @@@+(.*)$`)
 )
 
 var languageExtensions = map[string]string{
@@ -136,6 +171,8 @@ func Parse(input string) (*Diff, error) {
 	var currentFile *FileDiff
 	var currentHunk *Hunk
 	oldLineNum, newLineNum := 0, 0
+	oldLeft, newLeft := 0, 0
+	var parentNums []int
 
 	for scanner.Scan() {
 		line := scanner.Text()
@@ -155,17 +192,118 @@ func Parse(input string) (*Diff, error) {
 			currentHunk = nil
 			continue
 		}
+		if matches := combinedHeaderRe.FindStringSubmatch(line); matches != nil {
+			if currentFile != nil {
+				if currentHunk != nil {
+					currentFile.Hunks = append(currentFile.Hunks, *currentHunk)
+				}
+				diff.Files = append(diff.Files, *currentFile)
+			}
+			currentFile = &FileDiff{
+				OldPath:  matches[1],
+				NewPath:  matches[1],
+				Language: detectLanguage(matches[1]),
+			}
+			currentHunk = nil
+			continue
+		}
 
 		if currentFile == nil {
 			continue
 		}
 
-		if strings.HasPrefix(line, "new file mode") {
+		if matches := combinedHunkHeaderRe.FindStringSubmatch(line); matches != nil {
+			if currentHunk != nil {
+				currentFile.Hunks = append(currentFile.Hunks, *currentHunk)
+			}
+			currentHunk = parseCombinedHunkHeader(matches)
+			currentFile.Parents = len(currentHunk.Parents)
+			parentNums = make([]int, len(currentHunk.Parents))
+			for i, r := range currentHunk.Parents {
+				parentNums[i] = r.Start
+			}
+			newLineNum = currentHunk.NewStart
+			continue
+		}
+		if currentHunk != nil && currentFile.Parents > 0 && !strings.HasPrefix(line, `\ `) {
+			if l, ok := parseCombinedLine(line, parentNums, newLineNum); ok {
+				currentHunk.Lines = append(currentHunk.Lines, l)
+				if l.Type != LineRemoved {
+					newLineNum++
+				}
+			}
+			continue
+		}
+
+		// Lines past the end of a hunk, like a mail signature or the blank line
+		// between commits in git log -p, don't belong to it.
+		if currentHunk != nil && (oldLeft > 0 || newLeft > 0 || strings.HasPrefix(line, `\ `)) {
+			if strings.HasPrefix(line, `\ `) {
+				if n := len(currentHunk.Lines); n > 0 {
+					currentHunk.Lines[n-1].NoNewline = true
+				}
+				continue
+			}
+
+			var lineType LineType
+			content := line
+
+			switch {
+			case strings.HasPrefix(line, "+"):
+				lineType = LineAdded
+				content = strings.TrimPrefix(line, "+")
+				currentHunk.Lines = append(currentHunk.Lines, Line{
+					Type:    lineType,
+					Content: content,
+					NewNum:  newLineNum,
+				})
+				newLineNum++
+				newLeft--
+			case strings.HasPrefix(line, "-"):
+				lineType = LineRemoved
+				content = strings.TrimPrefix(line, "-")
+				currentHunk.Lines = append(currentHunk.Lines, Line{
+					Type:    lineType,
+					Content: content,
+					OldNum:  oldLineNum,
+				})
+				oldLineNum++
+				oldLeft--
+			case strings.HasPrefix(line, " ") || line == "":
+				lineType = LineContext
+				if strings.HasPrefix(line, " ") {
+					content = strings.TrimPrefix(line, " ")
+				}
+				currentHunk.Lines = append(currentHunk.Lines, Line{
+					Type:    lineType,
+					Content: content,
+					OldNum:  oldLineNum,
+					NewNum:  newLineNum,
+				})
+				oldLineNum++
+				newLineNum++
+				oldLeft--
+				newLeft--
+			}
+			continue
+		}
+
+		if mode, ok := strings.CutPrefix(line, "new file mode "); ok {
 			currentFile.IsNew = true
+			currentFile.NewMode = mode
 			continue
 		}
-		if strings.HasPrefix(line, "deleted file mode") {
+		if mode, ok := strings.CutPrefix(line, "deleted file mode "); ok {
 			currentFile.IsDeleted = true
+			currentFile.OldMode = mode
+			continue
+		}
+		if mode, ok := strings.CutPrefix(line, "old mode "); ok {
+			currentFile.OldMode = mode
+			continue
+		}
+		if mode, ok := strings.CutPrefix(line, "new mode "); ok {
+			currentFile.NewMode = mode
 			continue
 		}
 		if strings.HasPrefix(line, "rename from") || strings.HasPrefix(line, "rename to") {
@@ -218,47 +356,10 @@ func Parse(input string) (*Diff, error) {
 			}
 			oldLineNum = oldStart
 			newLineNum = newStart
+			oldLeft, newLeft = oldCount, newCount
 			continue
 		}
 
-		if currentHunk != nil {
-			var lineType LineType
-			content := line
-
-			switch {
-			case strings.HasPrefix(line, "+"):
-				lineType = LineAdded
-				content = strings.TrimPrefix(line, "+")
-				currentHunk.Lines = append(currentHunk.Lines, Line{
-					Type:    lineType,
-					Content: content,
-					NewNum:  newLineNum,
-				})
-				newLineNum++
-			case strings.HasPrefix(line, "-"):
-				lineType = LineRemoved
-				content = strings.TrimPrefix(line, "-")
-				currentHunk.Lines = append(currentHunk.Lines, Line{
-					Type:    lineType,
-					Content: content,
-					OldNum:  oldLineNum,
-				})
-				oldLineNum++
-			case strings.HasPrefix(line, " ") || line == "":
-				lineType = LineContext
-				if strings.HasPrefix(line, " ") {
-					content = strings.TrimPrefix(line, " ")
-				}
-				currentHunk.Lines = append(currentHunk.Lines, Line{
-					Type:    lineType,
-					Content: content,
-					OldNum:  oldLineNum,
-					NewNum:  newLineNum,
-				})
-				oldLineNum++
-				newLineNum++
-			}
-		}
 	}
 
 	if currentFile != nil {
@@ -274,24 +375,52 @@ func Parse(input string) (*Diff, error) {
 func (d *Diff) RawString() string {
 	var sb strings.Builder
 	for _, f := range d.Files {
-		sb.WriteString("diff --git a/" + f.OldPath + " b/" + f.NewPath + "\n")
+		sb.WriteString(f.DiffHeader())
 		for _, h := range f.Hunks {
-			sb.WriteString("@@ -" + strconv.Itoa(h.OldStart) + "," + strconv.Itoa(h.OldCount) +
-				" +" + strconv.Itoa(h.NewStart) + "," + strconv.Itoa(h.NewCount) + " @@")
-			if h.Header != "" {
-				sb.WriteString(" " + h.Header)
-			}
-			sb.WriteString("\n")
-			for _, l := range h.Lines {
-				switch l.Type {
-				case LineAdded:
-					sb.WriteString("+" + l.Content + "\n")
-				case LineRemoved:
-					sb.WriteString("-" + l.Content + "\n")
-				case LineContext:
-					sb.WriteString(" " + l.Content + "\n")
-				}
-			}
+			sb.WriteString(h.RawString())
+		}
+	}
+	return sb.String()
+}
+
+func (f *FileDiff) DiffHeader() string {
+	if f.Parents > 0 {
+		return "diff --cc " + f.NewPath + "\n"
+	}
+	return "diff --git a/" + f.OldPath + " b/" + f.NewPath + "\n"
+}
+
+// Range returns the hunk header without the function context, e.g.
+// "@@ -1,3 +1,4 @@".
+func (h *Hunk) Range() string {
+	if len(h.Parents) > 0 {
+		return h.combinedRange()
+	}
+	return "@@ -" + strconv.Itoa(h.OldStart) + "," + strconv.Itoa(h.OldCount) +
+		" +" + strconv.Itoa(h.NewStart) + "," + strconv.Itoa(h.NewCount) + " @@"
+}
+
+func (h *Hunk) RawString() string {
+	if len(h.Parents) > 0 {
+		return h.combinedString()
+	}
+	var sb strings.Builder
+	sb.WriteString(h.Range())
+	if h.Header != "" {
+		sb.WriteString(" " + h.Header)
+	}
+	sb.WriteString("\n")
+	for _, l := range h.Lines {
+		switch l.Type {
+		case LineAdded:
+			sb.WriteString("+" + l.Content + "\n")
+		case LineRemoved:
+			sb.WriteString("-" + l.Content + "\n")
+		case LineContext:
+			sb.WriteString(" " + l.Content + "\n")
+		}
+		if l.NoNewline {
+			sb.WriteString("\\ No newline at end of file\n")
 		}
 	}
 	return sb.String()
@@ -0,0 +1,51 @@
+package diff
+
+import (
+	"strings"
+)
+
+func FormatPatch(f *FileDiff, hunks []*Hunk) string {
+	var sb strings.Builder
+	sb.WriteString(f.DiffHeader())
+
+	switch {
+	case f.IsNew:
+		sb.WriteString("new file mode " + modeOrDefault(f.NewMode) + "\n")
+	case f.IsDeleted:
+		sb.WriteString("deleted file mode " + modeOrDefault(f.OldMode) + "\n")
+	case f.OldMode != "" && f.NewMode != "" && f.OldMode != f.NewMode:
+		sb.WriteString("old mode " + f.OldMode + "\n")
+		sb.WriteString("new mode " + f.NewMode + "\n")
+	}
+	if f.IsRenamed {
+		sb.WriteString("rename from " + f.OldPath + "\n")
+		sb.WriteString("rename to " + f.NewPath + "\n")
+	}
+
+	if len(hunks) == 0 {
+		return sb.String()
+	}
+
+	if f.IsNew {
+		sb.WriteString("--- /dev/null\n")
+	} else {
+		sb.WriteString("--- a/" + f.OldPath + "\n")
+	}
+	if f.IsDeleted {
+		sb.WriteString("+++ /dev/null\n")
+	} else {
+		sb.WriteString("+++ b/" + f.NewPath + "\n")
+	}
+
+	for _, h := range hunks {
+		sb.WriteString(h.withContext().RawString())
+	}
+	return sb.String()
+}
+
+func modeOrDefault(mode string) string {
+	if mode == "" {
+		return "100644"
+	}
+	return mode
+}
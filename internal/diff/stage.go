@@ -0,0 +1,88 @@
+package diff
+
+// Stage says where a change lives when staged and unstaged changes are
+// shown together.
+type Stage int
+
+const (
+	Staged Stage = 1 << iota
+	Unstaged
+)
+
+func (s Stage) String() string {
+	switch s {
+	case Staged:
+		return "staged"
+	case Unstaged:
+		return "unstaged"
+	case Staged | Unstaged:
+		return "partly staged"
+	}
+	return ""
+}
+
+// TagStages marks each changed line of combined, a diff from HEAD to the
+// working tree, as staged or unstaged. A removed line is staged when the
+// index removes it too. An added line is unstaged when it differs between
+// the index and the working tree.
+func TagStages(combined, staged, unstaged *Diff) {
+	removed := changedLines(staged, LineRemoved)
+	added := changedLines(unstaged, LineAdded)
+
+	for fi := range combined.Files {
+		f := &combined.Files[fi]
+		for hi := range f.Hunks {
+			lines := f.Hunks[hi].Lines
+			for li := range lines {
+				l := &lines[li]
+				switch l.Type {
+				case LineRemoved:
+					l.Stage = Unstaged
+					if removed[f.OldPath][l.OldNum] {
+						l.Stage = Staged
+					}
+				case LineAdded:
+					l.Stage = Staged
+					if added[f.NewPath][l.NewNum] {
+						l.Stage = Unstaged
+					}
+				}
+			}
+		}
+	}
+}
+
+func changedLines(d *Diff, lineType LineType) map[string]map[int]bool {
+	lines := make(map[string]map[int]bool)
+	for _, f := range d.Files {
+		path := f.NewPath
+		if lineType == LineRemoved {
+			path = f.OldPath
+		}
+		if lines[path] == nil {
+			lines[path] = make(map[int]bool)
+		}
+		for _, h := range f.Hunks {
+			for _, l := range h.Lines {
+				switch {
+				case l.Type != lineType:
+				case lineType == LineRemoved:
+					lines[path][l.OldNum] = true
+				default:
+					lines[path][l.NewNum] = true
+				}
+			}
+		}
+	}
+	return lines
+}
+
+// Stage combines the stages of the hunk's changed lines. It is zero when
+// the lines were never tagged.
+func (h *Hunk) Stage() Stage {
+	var s Stage
+	for _, l := range h.Lines {
+		s |= l.Stage
+	}
+	return s
+}
@@ -0,0 +1,93 @@
+package diff
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTagStages(t *testing.T) {
+	// HEAD has "one two three"; the index changes two to TWO and the working
+	// tree changes three to 3 on top of it.
+	const combined = `diff --git a/a.txt b/a.txt
+--- a/a.txt
++++ b/a.txt
+@@ -1,3 +1,3 @@
+ one
+-two
+-three
++TWO
++3
+`
+	const staged = `diff --git a/a.txt b/a.txt
+--- a/a.txt
++++ b/a.txt
+@@ -1,3 +1,3 @@
+ one
+-two
++TWO
+ three
+`
+	const unstaged = `diff --git a/a.txt b/a.txt
+--- a/a.txt
++++ b/a.txt
+@@ -1,3 +1,3 @@
+ one
+ TWO
+-three
++3
+`
+
+	tests := []struct {
+		name      string
+		staged    string
+		unstaged  string
+		want      []Stage
+		wantHunk  Stage
+		wantLabel string
+	}{
+		{
+			name:      "partly staged",
+			staged:    staged,
+			unstaged:  unstaged,
+			want:      []Stage{0, Staged, Unstaged, Staged, Unstaged},
+			wantHunk:  Staged | Unstaged,
+			wantLabel: "partly staged",
+		},
+		{
+			name:      "all staged",
+			staged:    combined,
+			want:      []Stage{0, Staged, Staged, Staged, Staged},
+			wantHunk:  Staged,
+			wantLabel: "staged",
+		},
+		{
+			name:      "all unstaged",
+			unstaged:  combined,
+			want:      []Stage{0, Unstaged, Unstaged, Unstaged, Unstaged},
+			wantHunk:  Unstaged,
+			wantLabel: "unstaged",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := mustParse(t, combined)
+			TagStages(d, mustParse(t, tt.staged), mustParse(t, tt.unstaged))
+
+			h := &d.Files[0].Hunks[0]
+			var got []Stage
+			for _, l := range h.Lines {
+				got = append(got, l.Stage)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("line stages = %v, want %v", got, tt.want)
+			}
+			if h.Stage() != tt.wantHunk {
+				t.Errorf("hunk stage = %v, want %v", h.Stage(), tt.wantHunk)
+			}
+			if h.Stage().String() != tt.wantLabel {
+				t.Errorf("label = %q, want %q", h.Stage().String(), tt.wantLabel)
+			}
+		})
+	}
+}
@@ -3,35 +3,46 @@ package git
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"os"
 	"os/exec"
 	"strings"
 	"time"
 )
 
+const DefaultTimeout = 30 * time.Second
+
 type Repository struct {
-	Path string
+	Path    string
+	Timeout time.Duration
 }
 
 func NewRepository(path string) *Repository {
-	return &Repository{Path: path}
+	return &Repository{Path: path, Timeout: DefaultTimeout}
 }
 
 func (r *Repository) execGit(ctx context.Context, args ...string) (string, error) {
-	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	return r.execGitInput(ctx, nil, args...)
+}
+
+func (r *Repository) execGitInput(ctx context.Context, stdin io.Reader, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.Timeout)
 	defer cancel()
 
 	cmd := exec.CommandContext(ctx, "git", args...)
 	if r.Path != "" {
 		cmd.Dir = r.Path
 	}
+	cmd.Stdin = stdin
 
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
 
 	if err := cmd.Run(); err != nil {
-		return "", fmt.Errorf("git %s: %w\n%s", strings.Join(args, " "), err, stderr.String())
+		return stdout.String(), fmt.Errorf("git %s: %w\n%s", strings.Join(args, " "), err, stderr.String())
 	}
 
 	return stdout.String(), nil
@@ -49,6 +60,46 @@ func (r *Repository) GetDiff(ctx context.Context, staged bool, paths ...string)
 	return r.execGit(ctx, args...)
 }
 
+// GetUntrackedDiff returns new-file diffs for the untracked files that are
+// not ignored, as if they had been added.
+func (r *Repository) GetUntrackedDiff(ctx context.Context, paths ...string) (string, error) {
+	args := []string{"ls-files", "--others", "--exclude-standard", "--full-name", "-z", "--"}
+	if len(paths) > 0 {
+		args = append(args, paths...)
+	} else {
+		// Like git diff, cover the whole tree even from a subdirectory.
+		args = append(args, ":/")
+	}
+	out, err := r.execGit(ctx, args...)
+	if err != nil {
+		return "", err
+	}
+	if out == "" {
+		return "", nil
+	}
+	files := strings.Split(strings.TrimSuffix(out, "\x00"), "\x00")
+
+	top, err := r.TopLevel(ctx)
+	if err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	for _, f := range files {
+		// A nested repository is listed as a directory; its files are not ours.
+		if strings.HasSuffix(f, "/") {
+			continue
+		}
+		// diff --no-index exits with 1 when the files differ, which they always do.
+		fileDiff, err := r.execGit(ctx, "-C", top, "diff", "--no-color", "--no-index", "-U3", "--", "/dev/null", f)
+		var exitErr *exec.ExitError
+		if err != nil && !(errors.As(err, &exitErr) && exitErr.ExitCode() == 1) {
+			return "", err
+		}
+		sb.WriteString(fileDiff)
+	}
+	return sb.String(), nil
+}
+
 func (r *Repository) GetDiffAgainstRef(ctx context.Context, ref string, paths ...string) (string, error) {
 	args := []string{"diff", "--no-color", "-U3", ref}
 	if len(paths) > 0 {
@@ -98,7 +149,146 @@ func (r *Repository) GetCommitDiff(ctx context.Context, commit string, paths ...
 	return r.execGit(ctx, args...)
 }
 
+type Commit struct {
+	SHA     string
+	Author  string
+	Date    string
+	Subject string
+	Body    string
+}
+
+// Commits lists the commits in revRange, oldest first, that touch paths.
+func (r *Repository) Commits(ctx context.Context, revRange string, paths ...string) ([]Commit, error) {
+	args := []string{"rev-list", "--reverse", "--no-commit-header", "--date=short",
+		"--format=%H%x1f%an%x1f%ad%x1f%s%x1f%b%x1e", revRange}
+	if len(paths) > 0 {
+		args = append(args, "--")
+		args = append(args, paths...)
+	}
+	out, err := r.execGit(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	var commits []Commit
+	for _, record := range strings.Split(out, "\x1e") {
+		fields := strings.Split(strings.TrimLeft(record, "\n"), "\x1f")
+		if len(fields) != 5 {
+			continue
+		}
+		commits = append(commits, Commit{
+			SHA:     fields[0],
+			Author:  fields[1],
+			Date:    fields[2],
+			Subject: fields[3],
+			Body:    strings.TrimSpace(fields[4]),
+		})
+	}
+	return commits, nil
+}
+
+func (c Commit) ShortSHA() string {
+	if len(c.SHA) > 7 {
+		return c.SHA[:7]
+	}
+	return c.SHA
+}
+
 func (r *Repository) IsValidRef(ctx context.Context, ref string) bool {
 	_, err := r.execGit(ctx, "rev-parse", "--verify", ref+"^{commit}")
 	return err == nil
 }
+
+func (r *Repository) GitDir(ctx context.Context) (string, error) {
+	out, err := r.execGit(ctx, "rev-parse", "--absolute-git-dir")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(out), nil
+}
+
+func (r *Repository) Editor(ctx context.Context) (string, error) {
+	out, err := r.execGit(ctx, "var", "GIT_EDITOR")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(out), nil
+}
+
+// CommitWithMessageFile commits the index with the message in path. git
+// runs on hnk's terminal and without a timeout, since hooks and commit
+// signing may prompt or take a while.
+func (r *Repository) CommitWithMessageFile(ctx context.Context, path string) error {
+	cmd := exec.CommandContext(ctx, "git", "commit", "--cleanup=strip", "-F", path)
+	if r.Path != "" {
+		cmd.Dir = r.Path
+	}
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("git commit: %w", err)
+	}
+	return nil
+}
+
+func (r *Repository) HasStagedChanges(ctx context.Context) (bool, error) {
+	out, err := r.execGit(ctx, "diff", "--cached", "--name-only")
+	if err != nil {
+		return false, err
+	}
+	return strings.TrimSpace(out) != "", nil
+}
+
+func (r *Repository) ApplyToIndex(ctx context.Context, patch string) error {
+	_, err := r.execGitInput(ctx, strings.NewReader(patch), "apply", "--cached", "-")
+	return err
+}
+
+// WriteTree stores the index as a tree and returns its id.
+func (r *Repository) WriteTree(ctx context.Context) (string, error) {
+	out, err := r.execGit(ctx, "write-tree")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(out), nil
+}
+
+// ReadTree replaces the index with tree, leaving the working tree alone.
+func (r *Repository) ReadTree(ctx context.Context, tree string) error {
+	_, err := r.execGit(ctx, "read-tree", tree)
+	return err
+}
+
+// Commit commits the index with message, like CommitWithMessageFile.
+func (r *Repository) Commit(ctx context.Context, message string) error {
+	f, err := os.CreateTemp("", "hnk-commit-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.WriteString(message)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return r.CommitWithMessageFile(ctx, f.Name())
+}
+
+func (r *Repository) TopLevel(ctx context.Context) (string, error) {
+	out, err := r.execGit(ctx, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(out), nil
+}
+
+// ShowFile returns the contents of path at rev, or in the index when rev is
+// empty. The path is relative to the top of the repository.
+func (r *Repository) ShowFile(ctx context.Context, rev, path string) (string, error) {
+	return r.execGit(ctx, "show", rev+":"+path)
+}
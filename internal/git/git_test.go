@@ -0,0 +1,103 @@
+package git
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// testRepo creates a repository with one commit, isolated from the user's
+// git configuration.
+func testRepo(t *testing.T) string {
+	t.Helper()
+	t.Setenv("GIT_CONFIG_GLOBAL", os.DevNull)
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	t.Setenv("GIT_AUTHOR_NAME", "t")
+	t.Setenv("GIT_AUTHOR_EMAIL", "t@t")
+	t.Setenv("GIT_COMMITTER_NAME", "t")
+	t.Setenv("GIT_COMMITTER_EMAIL", "t@t")
+
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"main.go": "package main\n", ".gitignore": "*.log\n"})
+	run(t, dir, "init", "-q")
+	run(t, dir, "add", ".")
+	run(t, dir, "commit", "-q", "-m", "initial")
+	return dir
+}
+
+func run(t *testing.T, dir string, args ...string) {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git %v: %v\n%s", args, err, out)
+	}
+}
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestGetUntrackedDiff(t *testing.T) {
+	dir := testRepo(t)
+	writeFiles(t, dir, map[string]string{
+		"new.go":         "package main\n\nfunc helper() {}\n",
+		"pkg/util.go":    "package pkg\n",
+		"debug.log":      "ignored\n",
+		"main.go":        "package main\n\nfunc main() {}\n",
+		"vendor/x/x.txt": "nested\n",
+	})
+	run(t, filepath.Join(dir, "vendor", "x"), "init", "-q")
+
+	newGo := "diff --git a/new.go b/new.go\n" +
+		"new file mode 100644\n" +
+		"index 0000000..9fa7315\n" +
+		"--- /dev/null\n" +
+		"+++ b/new.go\n" +
+		"@@ -0,0 +1,3 @@\n" +
+		"+package main\n" +
+		"+\n" +
+		"+func helper() {}\n"
+	utilGo := "diff --git a/pkg/util.go b/pkg/util.go\n" +
+		"new file mode 100644\n" +
+		"index 0000000..c1caffe\n" +
+		"--- /dev/null\n" +
+		"+++ b/pkg/util.go\n" +
+		"@@ -0,0 +1 @@\n" +
+		"+package pkg\n"
+
+	tests := []struct {
+		name  string
+		dir   string
+		paths []string
+		want  string
+	}{
+		{name: "whole repository", dir: dir, want: newGo + utilGo},
+		{name: "from a subdirectory", dir: filepath.Join(dir, "pkg"), want: newGo + utilGo},
+		{name: "limited to paths", dir: dir, paths: []string{"pkg"}, want: utilGo},
+		{name: "nothing untracked", dir: dir, paths: []string{"main.go"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewRepository(tt.dir).GetUntrackedDiff(context.Background(), tt.paths...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("GetUntrackedDiff =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
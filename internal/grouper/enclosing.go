@@ -0,0 +1,97 @@
+package grouper
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jm/hnk/internal/ai"
+	"github.com/jm/hnk/internal/diff"
+	"github.com/jm/hnk/internal/scope"
+)
+
+const DefaultContextTokens = 4000
+
+// SourceFunc returns the new version of a file, by its path in the diff.
+// commit is the commit being grouped, or empty for any other diff.
+type SourceFunc func(ctx context.Context, commit, path string) ([]byte, error)
+
+// SetFunctionContext adds the enclosing function or type of each hunk to
+// the prompt, read through source, up to a budget of tokens.
+func (g *Grouper) SetFunctionContext(source SourceFunc, tokens int) {
+	if tokens <= 0 {
+		tokens = DefaultContextTokens
+	}
+	g.source = source
+	g.contextTokens = tokens
+}
+
+func (g *Grouper) addFunctionContext(ctx context.Context, d *diff.Diff, commit string, files []ai.FileInfo) {
+	if g.source == nil {
+		return
+	}
+
+	budget := g.contextTokens
+	seen := make(map[string]bool)
+	for fi, f := range d.Files {
+		if f.IsNew || f.IsDeleted || f.IsBinary {
+			continue
+		}
+		src, err := g.source(ctx, commit, f.NewPath)
+		if err != nil {
+			continue
+		}
+
+		for hi := range f.Hunks {
+			start, end, changed := changedRange(&f.Hunks[hi])
+			block, ok := scope.Find(f.NewPath, src, start, end)
+			if !ok || block.End-block.Start+1 <= len(changed) {
+				continue
+			}
+			key := fmt.Sprintf("%s:%d", f.NewPath, block.Start)
+			if seen[key] {
+				continue
+			}
+
+			text := scope.Render(src, block, changed)
+			cost := len(text)/4 + 1
+			if cost > budget {
+				continue
+			}
+			budget -= cost
+			seen[key] = true
+			files[fi].Hunks[hi].Context = fmt.Sprintf("%s, lines %d-%d\n%s", block.Name, block.Start, block.End, text)
+		}
+	}
+}
+
+// changedRange returns the new-side lines that h adds, and the range they
+// span. A hunk that only removes lines adds none, so its range comes from
+// the old side instead: the lines around the removed ones, numbered as in
+// the new file.
+func changedRange(h *diff.Hunk) (start, end int, changed map[int]bool) {
+	changed = make(map[int]bool)
+	start, end = h.NewStart, h.NewStart
+	firstRemoved, lastRemoved, removed := 0, 0, 0
+	for _, l := range h.Lines {
+		switch l.Type {
+		case diff.LineAdded:
+			if len(changed) == 0 {
+				start = l.NewNum
+			}
+			changed[l.NewNum] = true
+			end = l.NewNum
+		case diff.LineRemoved:
+			if removed == 0 {
+				firstRemoved = l.OldNum
+			}
+			lastRemoved = l.OldNum
+			removed++
+		}
+	}
+	if len(changed) > 0 || removed == 0 {
+		return start, end, changed
+	}
+
+	offset := h.NewStart - h.OldStart
+	return max(firstRemoved-1+offset, 1), lastRemoved + 1 - removed + offset, changed
+}
@@ -0,0 +1,102 @@
+package grouper
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jm/hnk/internal/ai"
+	"github.com/jm/hnk/internal/diff"
+)
+
+func TestChangedRange(t *testing.T) {
+	tests := []struct {
+		name        string
+		hunk        diff.Hunk
+		start, end  int
+		wantChanged map[int]bool
+	}{
+		{
+			name: "added lines",
+			hunk: diff.Hunk{OldStart: 4, NewStart: 4, Lines: []diff.Line{
+				{Type: diff.LineContext, OldNum: 4, NewNum: 4},
+				{Type: diff.LineRemoved, OldNum: 5},
+				{Type: diff.LineAdded, NewNum: 5},
+				{Type: diff.LineAdded, NewNum: 6},
+				{Type: diff.LineContext, OldNum: 6, NewNum: 7},
+			}},
+			start: 5, end: 6, wantChanged: map[int]bool{5: true, 6: true},
+		},
+		{
+			name: "removed lines",
+			hunk: diff.Hunk{OldStart: 4, NewStart: 4, Lines: []diff.Line{
+				{Type: diff.LineContext, OldNum: 4, NewNum: 4},
+				{Type: diff.LineContext, OldNum: 5, NewNum: 5},
+				{Type: diff.LineRemoved, OldNum: 6},
+				{Type: diff.LineRemoved, OldNum: 7},
+				{Type: diff.LineContext, OldNum: 8, NewNum: 6},
+			}},
+			start: 5, end: 6, wantChanged: map[int]bool{},
+		},
+		{
+			name: "removed lines after earlier additions",
+			hunk: diff.Hunk{OldStart: 20, NewStart: 23, Lines: []diff.Line{
+				{Type: diff.LineContext, OldNum: 20, NewNum: 23},
+				{Type: diff.LineRemoved, OldNum: 21},
+				{Type: diff.LineContext, OldNum: 22, NewNum: 24},
+			}},
+			start: 23, end: 24, wantChanged: map[int]bool{},
+		},
+		{
+			name: "removed first line",
+			hunk: diff.Hunk{OldStart: 1, NewStart: 1, Lines: []diff.Line{
+				{Type: diff.LineRemoved, OldNum: 1},
+				{Type: diff.LineContext, OldNum: 2, NewNum: 1},
+			}},
+			start: 1, end: 1, wantChanged: map[int]bool{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, end, changed := changedRange(&tt.hunk)
+			if start != tt.start || end != tt.end {
+				t.Errorf("range = %d-%d, want %d-%d", start, end, tt.start, tt.end)
+			}
+			if !reflect.DeepEqual(changed, tt.wantChanged) {
+				t.Errorf("changed = %v, want %v", changed, tt.wantChanged)
+			}
+		})
+	}
+}
+
+func TestFunctionContextForRemovals(t *testing.T) {
+	src := "package demo\n\nfunc A() int {\n\treturn 1\n}\nfunc B() int {\n\tlog()\n\treturn 2\n}\n"
+	// The hunk starts inside A, but the line it removes was in B.
+	d, err := diff.Parse(`diff --git a/demo.go b/demo.go
+--- a/demo.go
++++ b/demo.go
+@@ -4,6 +4,5 @@ func A() int {
+ 	return 1
+ }
+ func B() int {
+-	debug()
+ 	log()
+ 	return 2
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	g := New(nil, nil)
+	g.SetFunctionContext(func(ctx context.Context, commit, path string) ([]byte, error) {
+		return []byte(src), nil
+	}, 0)
+	files := []ai.FileInfo{{Path: "demo.go", Hunks: make([]ai.HunkInfo, 1)}}
+	g.addFunctionContext(context.Background(), d, "", files)
+
+	if got := files[0].Hunks[0].Context; !strings.HasPrefix(got, "func B, lines 6-9\n") {
+		t.Errorf("Context = %q, want func B", got)
+	}
+}
@@ -6,6 +6,9 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"sort"
+	"strings"
+	"sync"
 
 	"github.com/jm/hnk/internal/ai"
 	"github.com/jm/hnk/internal/cache"
@@ -18,31 +21,224 @@ type GroupedHunk struct {
 	Hunk *diff.Hunk
 }
 
+func (gh GroupedHunk) Stage() diff.Stage {
+	return gh.Hunk.Stage()
+}
+
 type SemanticGroup struct {
 	Title       string
 	Description string
 	Hunks       []GroupedHunk
+	Children    []SemanticGroup
+	BuildsOn    []string
+	ai.Review
+
+	id        string
+	dependsOn []string
+}
+
+func (g *SemanticGroup) AllHunks() []GroupedHunk {
+	if len(g.Children) == 0 {
+		return g.Hunks
+	}
+	hunks := append([]GroupedHunk(nil), g.Hunks...)
+	for i := range g.Children {
+		hunks = append(hunks, g.Children[i].AllHunks()...)
+	}
+	return hunks
+}
+
+func (g *SemanticGroup) Leaves() []SemanticGroup {
+	if len(g.Children) == 0 {
+		return []SemanticGroup{*g}
+	}
+	var leaves []SemanticGroup
+	for i := range g.Children {
+		leaves = append(leaves, g.Children[i].Leaves()...)
+	}
+	return leaves
+}
+
+func (g *SemanticGroup) Stitched() []GroupedHunk {
+	order := make(map[*diff.FileDiff]int)
+	hunks := append([]GroupedHunk(nil), g.AllHunks()...)
+	for _, gh := range hunks {
+		if _, ok := order[gh.File]; !ok {
+			order[gh.File] = len(order)
+		}
+	}
+	sort.SliceStable(hunks, func(i, j int) bool {
+		if hunks[i].File != hunks[j].File {
+			return order[hunks[i].File] < order[hunks[j].File]
+		}
+		return hunks[i].Hunk.OldStart < hunks[j].Hunk.OldStart
+	})
+
+	var stitched []GroupedHunk
+	for _, gh := range hunks {
+		if n := len(stitched); n > 0 {
+			prev := &stitched[n-1]
+			if prev.File == gh.File && diff.Adjacent(prev.Hunk, gh.Hunk) {
+				merged := diff.Stitch(prev.Hunk, gh.Hunk)
+				prev.Hunk = &merged
+				continue
+			}
+		}
+		stitched = append(stitched, gh)
+	}
+	return stitched
+}
+
+func (g *SemanticGroup) RawString() string {
+	var files []*diff.FileDiff
+	hunks := make(map[*diff.FileDiff][]*diff.Hunk)
+	for _, gh := range g.Stitched() {
+		if _, ok := hunks[gh.File]; !ok {
+			files = append(files, gh.File)
+		}
+		hunks[gh.File] = append(hunks[gh.File], gh.Hunk)
+	}
+
+	var sb strings.Builder
+	for _, f := range files {
+		sb.WriteString(diff.FormatPatch(f, hunks[f]))
+	}
+	return sb.String()
 }
 
 type Grouper struct {
-	ai         *ai.ClaudeCLI
+	ai         ai.Analyzer
 	cache      *cache.Cache
 	spinnerOut io.Writer
+	splitHunks bool
+	order      string
+	onProgress func(done, total int)
+
+	// mu guards report, since the commits of a log are grouped side by
+	// side.
+	mu     sync.Mutex
+	report Report
+
+	source        SourceFunc
+	contextTokens int
+	concernsOnly  bool
 }
 
-func New(ai *ai.ClaudeCLI, c *cache.Cache) *Grouper {
-	return &Grouper{ai: ai, cache: c, spinnerOut: os.Stderr}
+type Report struct {
+	Usage       ai.Usage
+	Cached      bool
+	CachedUsage *ai.Usage
+	Model       string
+	Fallbacks   []ai.FallbackEvent
+	// ModelUsage splits Usage by model.
+	ModelUsage []ai.Usage
+	// Err is the AI failure that made the grouper fall back to heuristics.
+	Err error
+	// MergeErr is the failure to merge the batches of a large diff, which
+	// left the groups of each batch.
+	MergeErr error
+}
+
+func New(ai ai.Analyzer, c *cache.Cache) *Grouper {
+	return &Grouper{ai: ai, cache: c, spinnerOut: os.Stderr, splitHunks: true, order: OrderAI}
 }
 
 func (g *Grouper) SetSpinnerOutput(w io.Writer) {
 	g.spinnerOut = w
 }
 
+func (g *Grouper) SetSplitHunks(enabled bool) {
+	g.splitHunks = enabled
+}
+
+func (g *Grouper) Ask(ctx context.Context, group SemanticGroup, history []ai.Exchange, question string) (string, error) {
+	if g.ai == nil {
+		return "", fmt.Errorf("questions need an AI backend, but hnk is running offline")
+	}
+	return g.ai.Ask(ctx, group.RawString(), history, question)
+}
+
+// SetConcernsOnly limits the results to groups that need attention.
+func (g *Grouper) SetConcernsOnly(enabled bool) {
+	g.concernsOnly = enabled
+}
+
+func (g *Grouper) SetProgress(onProgress func(done, total int)) {
+	g.onProgress = onProgress
+}
+
+func (g *Grouper) withProgress(ctx context.Context, spin *spinner.Spinner) context.Context {
+	return ai.WithProgress(ctx, func(done, total int) {
+		spin.SetMessage(fmt.Sprintf("Analyzing changes (%d/%d batches)...", done, total))
+		if g.onProgress != nil {
+			g.onProgress(done, total)
+		}
+	})
+}
+
+func (g *Grouper) SetOrder(order string) error {
+	switch order {
+	case OrderAI, OrderFile:
+		g.order = order
+		return nil
+	default:
+		return fmt.Errorf("unknown group order %q (want %s or %s)", order, OrderAI, OrderFile)
+	}
+}
+
+func (g *Grouper) Report() Report {
+	g.mu.Lock()
+	r := g.report
+	g.mu.Unlock()
+	r.Usage = g.usage()
+	if m, ok := g.ai.(ai.ModelUsageReporter); ok {
+		r.ModelUsage = m.ModelUsage()
+	}
+	if m, ok := g.ai.(ai.ModelReporter); ok {
+		r.Model = m.ActiveModel()
+		r.Fallbacks = m.Fallbacks()
+	}
+	return r
+}
+
+func (g *Grouper) usage() ai.Usage {
+	if r, ok := g.ai.(ai.UsageReporter); ok {
+		return r.Usage()
+	}
+	return ai.Usage{}
+}
+
 func (g *Grouper) GroupDiff(ctx context.Context, d *diff.Diff) ([]SemanticGroup, error) {
+	groups, err := g.group(ctx, d, "", nil, nil)
+	return g.flagged(groups), err
+}
+
+// GroupDiffStream passes groups to onGroup as they are found. onReset is
+// called when the groups passed on so far are replaced, because the model's
+// answer was corrected or the grouper fell back to heuristics; the new
+// groups follow.
+func (g *Grouper) GroupDiffStream(ctx context.Context, d *diff.Diff, onGroup func(SemanticGroup), onReset func()) ([]SemanticGroup, error) {
+	if g.concernsOnly {
+		emit := onGroup
+		onGroup = func(group SemanticGroup) {
+			if group, ok := Flagged(group); ok {
+				emit(group)
+			}
+		}
+	}
+	groups, err := g.group(ctx, d, "", onGroup, onReset)
+	return g.flagged(groups), err
+}
+
+func (g *Grouper) group(ctx context.Context, d *diff.Diff, commit string, onGroup func(SemanticGroup), onReset func()) ([]SemanticGroup, error) {
 	if len(d.Files) == 0 {
 		return nil, nil
 	}
 
+	if g.splitHunks {
+		d = diff.SplitAtoms(d)
+	}
+
 	totalHunks := 0
 	for _, f := range d.Files {
 		totalHunks += len(f.Hunks)
@@ -51,49 +247,195 @@ func (g *Grouper) GroupDiff(ctx context.Context, d *diff.Diff) ([]SemanticGroup,
 		return nil, nil
 	}
 
-	if totalHunks == 1 && len(d.Files) == 1 {
-		return g.singleHunkGroup(ctx, d)
+	streamer, canStream := g.ai.(ai.StreamAnalyzer)
+	if onGroup == nil || !canStream || totalHunks == 1 || g.order == OrderFile {
+		groups, err := g.groupAll(ctx, d, totalHunks, commit)
+		if err != nil {
+			return nil, err
+		}
+		if g.order == OrderFile {
+			groups = sortByPosition(d, groups)
+		} else {
+			groups = sortByDependencies(groups)
+		}
+		for _, group := range groups {
+			if onGroup != nil {
+				onGroup(group)
+			}
+		}
+		return groups, nil
 	}
 
 	rawDiff := d.RawString()
-	cacheKey := cache.HashKey(rawDiff)
-
-	if g.cache != nil {
-		if cached, ok := g.cache.Get(cacheKey); ok {
-			var analysis ai.SemanticAnalysis
-			if err := json.Unmarshal([]byte(cached), &analysis); err == nil {
-				return g.buildGroups(d, &analysis), nil
-			}
+	cacheKey := cacheKey(commit, rawDiff)
+	if analysis, ok := g.cached(cacheKey); ok {
+		groups := sortByDependencies(g.buildGroups(d, analysis))
+		for _, group := range groups {
+			onGroup(group)
 		}
+		return groups, nil
 	}
 
-	catalog := g.buildCatalog(d)
+	catalog := g.buildCatalog(ctx, d, commit)
 
+	before := g.usage()
 	spin := spinner.New(g.spinnerOut, "Analyzing changes...")
+	var groups []SemanticGroup
+	var b *groupBuilder
+	var seq *sequencer
+	// reset starts over, taking back the groups already passed on when the
+	// analysis that follows replaces them.
+	reset := func() {
+		if len(groups) > 0 {
+			onReset()
+		}
+		groups = nil
+		b = newGroupBuilder(d)
+		seq = newSequencer(func(group SemanticGroup) {
+			spin.Stop()
+			groups = append(groups, group)
+			onGroup(group)
+		})
+	}
+	reset()
+
+	actx, cancel := analysisContext(ctx)
+	defer cancel()
 	spin.Start()
-	analysis, err := g.ai.AnalyzeDiff(ctx, catalog, rawDiff)
+	analysis, err := streamer.AnalyzeDiffStream(g.withProgress(actx, spin), catalog, rawDiff, func(ag ai.SemanticGroup) {
+		if group, ok := b.add(ag); ok {
+			seq.add(group)
+		}
+	}, reset)
 	spin.Stop()
 
 	if err != nil {
-		return g.fallbackGrouping(d), nil
+		if err := g.aiFailed(actx, err); err != nil {
+			return groups, err
+		}
+		reset()
+		for _, hg := range HeuristicGrouping(d) {
+			if group, ok := b.addGrouped(hg); ok {
+				seq.add(group)
+			}
+		}
+		seq.finish()
+		return groups, nil
+	}
+
+	g.record(cacheKey, analysis, before)
+
+	if leftovers := b.leftovers(); len(leftovers) > 0 {
+		seq.add(SemanticGroup{
+			Title:       generateTitle(leftovers[0].File, leftovers[0].Hunk),
+			Description: "Additional changes",
+			Hunks:       leftovers,
+		})
+	}
+	seq.finish()
+	return groups, nil
+}
+
+func (g *Grouper) groupAll(ctx context.Context, d *diff.Diff, totalHunks int, commit string) ([]SemanticGroup, error) {
+	if g.ai == nil {
+		return HeuristicGrouping(d), nil
+	}
+
+	if totalHunks == 1 && len(d.Files) == 1 {
+		return g.singleHunkGroup(ctx, d)
 	}
 
-	if g.cache != nil {
-		if data, err := json.Marshal(analysis); err == nil {
-			g.cache.Set(cacheKey, string(data))
+	rawDiff := d.RawString()
+	cacheKey := cacheKey(commit, rawDiff)
+	if analysis, ok := g.cached(cacheKey); ok {
+		return g.buildGroups(d, analysis), nil
+	}
+
+	catalog := g.buildCatalog(ctx, d, commit)
+
+	before := g.usage()
+	spin := spinner.New(g.spinnerOut, "Analyzing changes...")
+	actx, cancel := analysisContext(ctx)
+	defer cancel()
+	spin.Start()
+	analysis, err := g.ai.AnalyzeDiff(g.withProgress(actx, spin), catalog, rawDiff)
+	spin.Stop()
+
+	if err != nil {
+		if err := g.aiFailed(actx, err); err != nil {
+			return nil, err
 		}
+		return HeuristicGrouping(d), nil
 	}
 
+	g.record(cacheKey, analysis, before)
+
 	return g.buildGroups(d, analysis), nil
 }
 
-func (g *Grouper) buildCatalog(d *diff.Diff) *ai.DiffCatalog {
+// cacheKey keys the analysis of a commit by its SHA, and anything else by
+// its diff. The diff hash is kept for commits too, since paths and hunk
+// splitting change which hunks the analysis refers to.
+func cacheKey(commit, rawDiff string) string {
+	if commit == "" {
+		return cache.HashKey(rawDiff)
+	}
+	return "commit:" + commit + ":" + cache.HashKey(rawDiff)
+}
+
+func (g *Grouper) cached(key string) (*ai.SemanticAnalysis, bool) {
+	if g.cache == nil {
+		return nil, false
+	}
+	cached, ok := g.cache.Get(key)
+	if !ok {
+		return nil, false
+	}
+	var analysis ai.SemanticAnalysis
+	if err := json.Unmarshal([]byte(cached), &analysis); err != nil {
+		return nil, false
+	}
+	g.mu.Lock()
+	g.report.Cached = true
+	g.report.CachedUsage = analysis.Usage
+	g.mu.Unlock()
+	return &analysis, true
+}
+
+// record notes what an analysis cost and caches it. Per-batch groups left
+// by a failed merge are not cached, so the merge is tried again next time.
+// When commits are grouped side by side, the cost may include that of
+// the others in flight.
+func (g *Grouper) record(key string, analysis *ai.SemanticAnalysis, before ai.Usage) {
+	used := g.usage().Sub(before)
+	analysis.Usage = &used
+	if analysis.MergeErr != nil {
+		g.mu.Lock()
+		g.report.MergeErr = analysis.MergeErr
+		g.mu.Unlock()
+		return
+	}
+	g.store(key, analysis)
+}
+
+func (g *Grouper) store(key string, analysis *ai.SemanticAnalysis) {
+	if g.cache == nil {
+		return
+	}
+	if data, err := json.Marshal(analysis); err == nil {
+		g.cache.Set(key, string(data))
+	}
+}
+
+func (g *Grouper) buildCatalog(ctx context.Context, d *diff.Diff, commit string) *ai.DiffCatalog {
 	var files []ai.FileInfo
 	for _, f := range d.Files {
 		fi := ai.FileInfo{
-			Path:      f.NewPath,
-			IsNew:     f.IsNew,
-			IsDeleted: f.IsDeleted,
+			Path:       f.NewPath,
+			DiffHeader: f.DiffHeader(),
+			IsNew:      f.IsNew,
+			IsDeleted:  f.IsDeleted,
+			Parents:    f.Parents,
 		}
 		for _, h := range f.Hunks {
 			adds, removes := h.Stats()
@@ -103,10 +445,12 @@ func (g *Grouper) buildCatalog(d *diff.Diff) *ai.DiffCatalog {
 				Header:  h.Header,
 				Adds:    adds,
 				Removes: removes,
+				Text:    h.RawString(),
 			})
 		}
 		files = append(files, fi)
 	}
+	g.addFunctionContext(ctx, d, commit, files)
 	return ai.BuildCatalog(files)
 }
 
@@ -115,11 +459,16 @@ func (g *Grouper) singleHunkGroup(ctx context.Context, d *diff.Diff) ([]Semantic
 	hunk := file.Hunks[0]
 
 	spin := spinner.New(g.spinnerOut, "Analyzing changes...")
+	actx, cancel := analysisContext(ctx)
+	defer cancel()
 	spin.Start()
-	desc, err := g.ai.GenerateDescription(ctx, d.RawString())
+	desc, err := g.ai.GenerateDescription(actx, d.RawString())
 	spin.Stop()
 
 	if err != nil {
+		if err := g.aiFailed(actx, err); err != nil {
+			return nil, err
+		}
 		desc = fmt.Sprintf("Changes to %s", file.NewPath)
 	}
 
@@ -148,18 +497,29 @@ func generateTitle(f *diff.FileDiff, h *diff.Hunk) string {
 	return fmt.Sprintf("Modify %s", f.NewPath)
 }
 
-func (g *Grouper) fallbackGrouping(d *diff.Diff) []SemanticGroup {
+func (g *Grouper) buildGroups(d *diff.Diff, analysis *ai.SemanticAnalysis) []SemanticGroup {
 	var groups []SemanticGroup
+	b := newGroupBuilder(d)
+
+	for _, ag := range analysis.Groups {
+		if group, ok := b.add(ag); ok {
+			groups = append(groups, group)
+		}
+	}
 
-	for i := range d.Files {
-		file := &d.Files[i]
-		for j := range file.Hunks {
-			hunk := &file.Hunks[j]
-			title := generateTitle(file, hunk)
+	leftoverHunks := b.leftovers()
+	if len(leftoverHunks) > 0 {
+		if len(groups) > 0 {
+			last := &groups[len(groups)-1]
+			for len(last.Children) > 0 {
+				last = &last.Children[len(last.Children)-1]
+			}
+			last.Hunks = append(last.Hunks, leftoverHunks...)
+		} else {
 			groups = append(groups, SemanticGroup{
-				Title:       title,
-				Description: fmt.Sprintf("Changes to %s around line %d", file.NewPath, hunk.NewStart),
-				Hunks:       []GroupedHunk{{File: file, Hunk: hunk}},
+				Title:       generateTitle(leftoverHunks[0].File, leftoverHunks[0].Hunk),
+				Description: "Additional changes",
+				Hunks:       leftoverHunks,
 			})
 		}
 	}
@@ -167,72 +527,103 @@ func (g *Grouper) fallbackGrouping(d *diff.Diff) []SemanticGroup {
 	return groups
 }
 
-func (g *Grouper) buildGroups(d *diff.Diff, analysis *ai.SemanticAnalysis) []SemanticGroup {
-	var groups []SemanticGroup
-	usedHunks := make(map[string]bool)
+type groupBuilder struct {
+	d    *diff.Diff
+	used map[*diff.Hunk]bool
+}
 
-	for _, ag := range analysis.Groups {
-		group := SemanticGroup{
-			Title:       ag.Title,
-			Description: ag.Description,
-		}
+func newGroupBuilder(d *diff.Diff) *groupBuilder {
+	return &groupBuilder{d: d, used: make(map[*diff.Hunk]bool)}
+}
 
-		for i, fileIdx := range ag.FileIndices {
-			if fileIdx < 0 || fileIdx >= len(d.Files) {
-				continue
+func (b *groupBuilder) add(ag ai.SemanticGroup) (SemanticGroup, bool) {
+	group := SemanticGroup{
+		Title:       ag.Title,
+		Description: ag.Description,
+		Review:      ag.Review,
+		id:          ag.ID,
+		dependsOn:   ag.DependsOn,
+	}
+
+	if len(ag.Children) > 0 {
+		for _, child := range ag.Children {
+			if c, ok := b.add(child); ok {
+				group.Children = append(group.Children, c)
 			}
-			file := &d.Files[fileIdx]
+		}
+		return collapse(group)
+	}
+
+	for i, fileIdx := range ag.FileIndices {
+		if fileIdx < 0 || fileIdx >= len(b.d.Files) {
+			continue
+		}
+		file := &b.d.Files[fileIdx]
+
+		if i >= len(ag.HunkIndices) {
+			continue
+		}
 
-			if i >= len(ag.HunkIndices) || len(ag.HunkIndices[i]) == 0 {
+		for _, hunkIdx := range ag.HunkIndices[i] {
+			if hunkIdx < 0 || hunkIdx >= len(file.Hunks) {
 				continue
 			}
-			hunkIndices := ag.HunkIndices[i]
-
-			for _, hunkIdx := range hunkIndices {
-				if hunkIdx < 0 || hunkIdx >= len(file.Hunks) {
-					continue
-				}
-				key := fmt.Sprintf("%d-%d", fileIdx, hunkIdx)
-				if usedHunks[key] {
-					continue
-				}
-				usedHunks[key] = true
-				group.Hunks = append(group.Hunks, GroupedHunk{
-					File: file,
-					Hunk: &file.Hunks[hunkIdx],
-				})
+			hunk := &file.Hunks[hunkIdx]
+			if b.used[hunk] {
+				continue
 			}
+			b.used[hunk] = true
+			group.Hunks = append(group.Hunks, GroupedHunk{File: file, Hunk: hunk})
 		}
+	}
 
-		if len(group.Hunks) > 0 {
-			groups = append(groups, group)
-		}
+	return group, len(group.Hunks) > 0
+}
+
+// collapse turns a theme whose other sub-groups all came up empty into a
+// plain group under the theme's title.
+func collapse(group SemanticGroup) (SemanticGroup, bool) {
+	switch len(group.Children) {
+	case 0:
+		return group, false
+	case 1:
+		group.Hunks = group.Children[0].AllHunks()
+		group.Review.Merge(group.Children[0].Review)
+		group.Children = nil
 	}
+	return group, true
+}
 
-	var leftoverHunks []GroupedHunk
-	for fileIdx, file := range d.Files {
-		for hunkIdx := range file.Hunks {
-			key := fmt.Sprintf("%d-%d", fileIdx, hunkIdx)
-			if usedHunks[key] {
-				continue
+func (b *groupBuilder) addGrouped(sg SemanticGroup) (SemanticGroup, bool) {
+	group := SemanticGroup{Title: sg.Title, Description: sg.Description, Review: sg.Review,
+		id: sg.id, dependsOn: sg.dependsOn}
+	if len(sg.Children) > 0 {
+		for _, child := range sg.Children {
+			if c, ok := b.addGrouped(child); ok {
+				group.Children = append(group.Children, c)
 			}
-			f := &d.Files[fileIdx]
-			h := &f.Hunks[hunkIdx]
-			leftoverHunks = append(leftoverHunks, GroupedHunk{File: f, Hunk: h})
 		}
+		return collapse(group)
 	}
-
-	if len(leftoverHunks) > 0 {
-		if len(groups) > 0 {
-			groups[len(groups)-1].Hunks = append(groups[len(groups)-1].Hunks, leftoverHunks...)
-		} else {
-			groups = append(groups, SemanticGroup{
-				Title:       generateTitle(leftoverHunks[0].File, leftoverHunks[0].Hunk),
-				Description: "Additional changes",
-				Hunks:       leftoverHunks,
-			})
+	for _, gh := range sg.Hunks {
+		if b.used[gh.Hunk] {
+			continue
 		}
+		b.used[gh.Hunk] = true
+		group.Hunks = append(group.Hunks, gh)
 	}
+	return group, len(group.Hunks) > 0
+}
 
-	return groups
+func (b *groupBuilder) leftovers() []GroupedHunk {
+	var hunks []GroupedHunk
+	for i := range b.d.Files {
+		f := &b.d.Files[i]
+		for j := range f.Hunks {
+			if !b.used[&f.Hunks[j]] {
+				hunks = append(hunks, GroupedHunk{File: f, Hunk: &f.Hunks[j]})
+			}
+		}
+	}
+	return hunks
 }
@@ -0,0 +1,320 @@
+package grouper
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/jm/hnk/internal/diff"
+)
+
+var (
+	definitionRe = regexp.MustCompile(`\b(?:func\s+(?:\([^)]*\)\s*)?|type\s+|var\s+|const\s+|def\s+|class\s+|function\s+|fn\s+|struct\s+|interface\s+)([A-Za-z_]\w*)`)
+	identRe      = regexp.MustCompile(`[A-Za-z_]\w*`)
+)
+
+const minSymbolLen = 4
+
+type hunkRef struct {
+	file int
+	hunk int
+}
+
+type unionFind struct {
+	parent map[hunkRef]hunkRef
+}
+
+func (u *unionFind) find(x hunkRef) hunkRef {
+	p, ok := u.parent[x]
+	if !ok || p == x {
+		return x
+	}
+	root := u.find(p)
+	u.parent[x] = root
+	return root
+}
+
+func (u *unionFind) union(a, b hunkRef) {
+	ra, rb := u.find(a), u.find(b)
+	if ra == rb {
+		return
+	}
+	if rb.file < ra.file || (rb.file == ra.file && rb.hunk < ra.hunk) {
+		ra, rb = rb, ra
+	}
+	u.parent[rb] = ra
+}
+
+func HeuristicGrouping(d *diff.Diff) []SemanticGroup {
+	uf := &unionFind{parent: make(map[hunkRef]hunkRef)}
+
+	var refs []hunkRef
+	firstInFile := make(map[int]hunkRef)
+	for i := range d.Files {
+		for j := range d.Files[i].Hunks {
+			ref := hunkRef{i, j}
+			refs = append(refs, ref)
+
+			if first, ok := firstInFile[i]; ok {
+				uf.union(first, ref)
+			} else {
+				firstInFile[i] = ref
+			}
+		}
+	}
+
+	linkTestPairs(d, uf, firstInFile)
+	linkSharedSymbols(d, uf, refs)
+	linkPackages(d, uf, firstInFile)
+
+	var order []hunkRef
+	members := make(map[hunkRef][]hunkRef)
+	for _, ref := range refs {
+		root := uf.find(ref)
+		if _, ok := members[root]; !ok {
+			order = append(order, root)
+		}
+		members[root] = append(members[root], ref)
+	}
+
+	var groups []SemanticGroup
+	for _, root := range order {
+		var hunks []GroupedHunk
+		for _, ref := range members[root] {
+			f := &d.Files[ref.file]
+			hunks = append(hunks, GroupedHunk{File: f, Hunk: &f.Hunks[ref.hunk]})
+		}
+		groups = append(groups, SemanticGroup{
+			Title:       heuristicTitle(hunks),
+			Description: heuristicDescription(hunks),
+			Hunks:       hunks,
+		})
+	}
+	return groups
+}
+
+func filePath(f *diff.FileDiff) string {
+	if f.IsDeleted {
+		return f.OldPath
+	}
+	return f.NewPath
+}
+
+func linkTestPairs(d *diff.Diff, uf *unionFind, firstInFile map[int]hunkRef) {
+	impls := make(map[string][]int)
+	var tests []int
+	for i := range d.Files {
+		if _, ok := firstInFile[i]; !ok {
+			continue
+		}
+		subject, isTest := testSubject(filePath(&d.Files[i]))
+		if isTest {
+			tests = append(tests, i)
+			continue
+		}
+		impls[subject] = append(impls[subject], i)
+	}
+
+	for _, t := range tests {
+		subject, _ := testSubject(filePath(&d.Files[t]))
+		for _, impl := range impls[subject] {
+			uf.union(firstInFile[impl], firstInFile[t])
+		}
+	}
+}
+
+// testSubject returns the directory and name of the code a file tests, or
+// of the file itself when it is not a test. Tests kept in a test, tests or
+// __tests__ directory belong to the directory above it.
+func testSubject(p string) (string, bool) {
+	dir, base := path.Split(p)
+	dir = path.Clean(dir)
+	ext := path.Ext(base)
+	name := strings.TrimSuffix(base, ext)
+
+	isTest := false
+	for _, suffix := range []string{"_test", ".test", ".spec", "_spec"} {
+		if strings.HasSuffix(name, suffix) {
+			name, isTest = strings.TrimSuffix(name, suffix), true
+			break
+		}
+	}
+	if !isTest && strings.HasPrefix(name, "test_") {
+		name, isTest = strings.TrimPrefix(name, "test_"), true
+	}
+	if isTest {
+		switch path.Base(dir) {
+		case "test", "tests", "__tests__":
+			dir = path.Dir(dir)
+		}
+	}
+	return path.Join(dir, name), isTest
+}
+
+func linkSharedSymbols(d *diff.Diff, uf *unionFind, refs []hunkRef) {
+	definedBy := make(map[string]hunkRef)
+	for _, ref := range refs {
+		h := &d.Files[ref.file].Hunks[ref.hunk]
+		for _, l := range h.Lines {
+			if l.Type != diff.LineAdded {
+				continue
+			}
+			for _, m := range definitionRe.FindAllStringSubmatch(l.Content, -1) {
+				if len(m[1]) < minSymbolLen {
+					continue
+				}
+				if _, ok := definedBy[m[1]]; !ok {
+					definedBy[m[1]] = ref
+				}
+			}
+		}
+	}
+	if len(definedBy) == 0 {
+		return
+	}
+
+	for _, ref := range refs {
+		h := &d.Files[ref.file].Hunks[ref.hunk]
+		for _, l := range h.Lines {
+			if l.Type == diff.LineContext {
+				continue
+			}
+			for _, ident := range identRe.FindAllString(l.Content, -1) {
+				if def, ok := definedBy[ident]; ok && def != ref {
+					uf.union(def, ref)
+				}
+			}
+		}
+	}
+}
+
+// linkPackages is the weakest pass: it groups the files that no stronger
+// link joined to another file with the other such files in their directory,
+// so a package's scattered edits read as one change without swallowing the
+// groups that the file, test and symbol passes found.
+func linkPackages(d *diff.Diff, uf *unionFind, firstInFile map[int]hunkRef) {
+	filesIn := make(map[hunkRef]int)
+	for _, first := range firstInFile {
+		filesIn[uf.find(first)]++
+	}
+
+	loneInDir := make(map[string]hunkRef)
+	for i := range d.Files {
+		first, ok := firstInFile[i]
+		if !ok || filesIn[uf.find(first)] > 1 {
+			continue
+		}
+		dir := path.Dir(filePath(&d.Files[i]))
+		if lone, ok := loneInDir[dir]; ok {
+			uf.union(lone, first)
+		} else {
+			loneInDir[dir] = first
+		}
+	}
+}
+
+func heuristicTitle(hunks []GroupedHunk) string {
+	allNew, allDeleted := true, true
+	var symbols, files []string
+	seenSymbol := make(map[string]bool)
+	seenFile := make(map[string]bool)
+	for _, gh := range hunks {
+		allNew = allNew && gh.File.IsNew
+		allDeleted = allDeleted && gh.File.IsDeleted
+
+		p := filePath(gh.File)
+		if !seenFile[p] {
+			seenFile[p] = true
+			files = append(files, p)
+		}
+
+		if m := definitionRe.FindStringSubmatch(gh.Hunk.Header); m != nil && len(m[1]) >= minSymbolLen && !seenSymbol[m[1]] {
+			seenSymbol[m[1]] = true
+			symbols = append(symbols, m[1])
+		}
+	}
+
+	verb := "Update"
+	switch {
+	case allNew:
+		verb = "Add"
+	case allDeleted:
+		verb = "Remove"
+	}
+
+	if len(files) == 1 && (allNew || allDeleted || len(symbols) == 0) {
+		return fmt.Sprintf("%s %s", verb, files[0])
+	}
+
+	where := commonDir(files)
+	if len(symbols) == 0 {
+		return fmt.Sprintf("%s %s", verb, summarizeNames(baseNames(files)))
+	}
+	if where == "." || where == "" {
+		return fmt.Sprintf("%s %s", verb, summarizeNames(symbols))
+	}
+	return fmt.Sprintf("%s %s in %s", verb, summarizeNames(symbols), where)
+}
+
+func heuristicDescription(hunks []GroupedHunk) string {
+	files := make(map[string]bool)
+	adds, removes := 0, 0
+	for _, gh := range hunks {
+		files[filePath(gh.File)] = true
+		a, r := gh.Hunk.Stats()
+		adds += a
+		removes += r
+	}
+
+	names := make([]string, 0, len(files))
+	for f := range files {
+		names = append(names, f)
+	}
+	sort.Strings(names)
+
+	return fmt.Sprintf("%s (+%d/-%d) in %s", Plural(len(hunks), "hunk"), adds, removes, summarizeNames(names))
+}
+
+// Plural counts n of word, e.g. "1 hunk" or "3 hunks".
+func Plural(n int, word string) string {
+	if n == 1 {
+		return "1 " + word
+	}
+	return fmt.Sprintf("%d %ss", n, word)
+}
+
+func summarizeNames(names []string) string {
+	switch len(names) {
+	case 0:
+		return ""
+	case 1:
+		return names[0]
+	case 2:
+		return names[0] + " and " + names[1]
+	default:
+		return fmt.Sprintf("%s, %s and %d more", names[0], names[1], len(names)-2)
+	}
+}
+
+func baseNames(paths []string) []string {
+	names := make([]string, len(paths))
+	for i, p := range paths {
+		names[i] = path.Base(p)
+	}
+	return names
+}
+
+func commonDir(paths []string) string {
+	if len(paths) == 0 {
+		return ""
+	}
+	dir := path.Dir(paths[0])
+	for _, p := range paths[1:] {
+		for dir != "." && dir != "/" && !strings.HasPrefix(p, dir+"/") {
+			dir = path.Dir(dir)
+		}
+	}
+	return dir
+}
@@ -0,0 +1,212 @@
+package grouper
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/jm/hnk/internal/diff"
+)
+
+// hunk builds a hunk from lines that start with +, - or a space.
+func hunk(header string, lines ...string) diff.Hunk {
+	h := diff.Hunk{Header: header}
+	for _, l := range lines {
+		t := diff.LineContext
+		switch l[0] {
+		case '+':
+			t = diff.LineAdded
+		case '-':
+			t = diff.LineRemoved
+		}
+		h.Lines = append(h.Lines, diff.Line{Type: t, Content: l[1:]})
+	}
+	return h
+}
+
+func file(p string, hunks ...diff.Hunk) diff.FileDiff {
+	return diff.FileDiff{OldPath: p, NewPath: p, Hunks: hunks}
+}
+
+func TestTestSubject(t *testing.T) {
+	tests := []struct {
+		path     string
+		want     string
+		wantTest bool
+	}{
+		{path: "internal/ai/chunk.go", want: "internal/ai/chunk"},
+		{path: "internal/ai/chunk_test.go", want: "internal/ai/chunk", wantTest: true},
+		{path: "main.go", want: "main"},
+		{path: "src/app.spec.ts", want: "src/app", wantTest: true},
+		{path: "src/app.test.js", want: "src/app", wantTest: true},
+		{path: "lib/user_spec.rb", want: "lib/user", wantTest: true},
+		{path: "lib/tests/test_parser.py", want: "lib/parser", wantTest: true},
+		{path: "web/__tests__/button.test.tsx", want: "web/button", wantTest: true},
+		{path: "test/helpers.js", want: "test/helpers"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got, isTest := testSubject(tt.path)
+			if got != tt.want || isTest != tt.wantTest {
+				t.Errorf("testSubject(%q) = %q, %v, want %q, %v", tt.path, got, isTest, tt.want, tt.wantTest)
+			}
+		})
+	}
+}
+
+func TestLinkSharedSymbols(t *testing.T) {
+	def := hunk("", "+func ParseConfig(path string) (*Config, error) {", "+}")
+
+	tests := []struct {
+		name string
+		def  diff.Hunk
+		use  diff.Hunk
+		want bool
+	}{
+		{name: "added definition used elsewhere", def: def, use: hunk("", "+\tcfg, err := ParseConfig(p)"), want: true},
+		{name: "removed use", def: def, use: hunk("", "-\tcfg, err := ParseConfig(p)"), want: true},
+		{name: "type definition", def: hunk("", "+type Settings struct {"), use: hunk("", "+var s Settings"), want: true},
+		{name: "use in a context line", def: def, use: hunk("", " \tcfg, err := ParseConfig(p)", "+\t_ = cfg")},
+		{name: "removed definition", def: hunk("", "-func ParseConfig(path string) (*Config, error) {"), use: hunk("", "+\tParseConfig(p)")},
+		{name: "short name", def: hunk("", "+func Run() {"), use: hunk("", "+\tRun()")},
+		{name: "unrelated", def: def, use: hunk("", "+\tLoadConfig(p)")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &diff.Diff{Files: []diff.FileDiff{file("a.go", tt.def), file("b.go", tt.use)}}
+			uf := &unionFind{parent: make(map[hunkRef]hunkRef)}
+			linkSharedSymbols(d, uf, []hunkRef{{0, 0}, {1, 0}})
+			if got := uf.find(hunkRef{0, 0}) == uf.find(hunkRef{1, 0}); got != tt.want {
+				t.Errorf("linked = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHeuristicGrouping(t *testing.T) {
+	tests := []struct {
+		name  string
+		files []diff.FileDiff
+		want  [][]string
+	}{
+		{
+			name: "hunks of a file stay together",
+			files: []diff.FileDiff{
+				file("a/x.go", hunk("func Alpha()", "+\treturn 1"), hunk("func Bravo()", "+\treturn 2")),
+				file("b/y.go", hunk("", "+\treturn 3")),
+			},
+			want: [][]string{{"a/x.go", "a/x.go"}, {"b/y.go"}},
+		},
+		{
+			name: "test with its implementation, other files by package",
+			files: []diff.FileDiff{
+				file("internal/ai/chunk.go", hunk("", "+\tbatches = nil")),
+				file("internal/ai/openai.go", hunk("", "+\ttimeout = 0")),
+				file("internal/ai/chunk_test.go", hunk("", "+\twant = nil")),
+				file("cmd/hnk/main.go", hunk("", "+\texit = 1")),
+				file("internal/ai/usage.go", hunk("", "+\tcost = 0")),
+			},
+			want: [][]string{
+				{"internal/ai/chunk.go", "internal/ai/chunk_test.go"},
+				{"internal/ai/openai.go", "internal/ai/usage.go"},
+				{"cmd/hnk/main.go"},
+			},
+		},
+		{
+			name: "tests in another directory don't pair",
+			files: []diff.FileDiff{
+				file("a/foo.go", hunk("", "+\tx = 1")),
+				file("b/foo_test.go", hunk("", "+\ty = 2")),
+			},
+			want: [][]string{{"a/foo.go"}, {"b/foo_test.go"}},
+		},
+		{
+			name: "shared symbols win over the package",
+			files: []diff.FileDiff{
+				file("a/x.go", hunk("", "+func LoadThing() {}")),
+				file("a/z.go", hunk("", "+\tz = 1")),
+				file("b/y.go", hunk("", "+\tLoadThing()")),
+			},
+			want: [][]string{{"a/x.go", "b/y.go"}, {"a/z.go"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			groups := HeuristicGrouping(&diff.Diff{Files: tt.files})
+			var got [][]string
+			for _, g := range groups {
+				var paths []string
+				for _, gh := range g.Hunks {
+					paths = append(paths, filePath(gh.File))
+				}
+				got = append(got, paths)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("groups = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHeuristicTitle(t *testing.T) {
+	added := file("internal/usage/usage.go", hunk("", "+package usage"))
+	added.IsNew = true
+	addedToo := file("internal/usage/usage_test.go", hunk("", "+package usage"))
+	addedToo.IsNew = true
+	deleted := file("old.go", hunk("func Legacy()", "-package old"))
+	deleted.IsDeleted = true
+
+	tests := []struct {
+		name  string
+		files []diff.FileDiff
+		want  string
+	}{
+		{name: "new file", files: []diff.FileDiff{added}, want: "Add internal/usage/usage.go"},
+		{name: "new files", files: []diff.FileDiff{added, addedToo}, want: "Add usage.go and usage_test.go"},
+		{name: "deleted file", files: []diff.FileDiff{deleted}, want: "Remove old.go"},
+		{name: "file without symbols", files: []diff.FileDiff{file("README.md", hunk("## Usage"))}, want: "Update README.md"},
+		{
+			name:  "symbol at the top level",
+			files: []diff.FileDiff{file("main.go", hunk("func runPatch(cmd *cli.Command) error"))},
+			want:  "Update runPatch",
+		},
+		{
+			name: "symbols in a directory",
+			files: []diff.FileDiff{
+				file("internal/ai/chunk.go", hunk("func splitCatalog(c *DiffCatalog) []catalogBatch")),
+				file("internal/ai/chunk_test.go", hunk("func TestSplitCatalog(t *testing.T) {")),
+			},
+			want: "Update splitCatalog and TestSplitCatalog in internal/ai",
+		},
+		{
+			name: "many symbols",
+			files: []diff.FileDiff{
+				file("pkg/a.go", hunk("func Alpha()"), hunk("type Bravo struct"), hunk("func Alpha()")),
+				file("pkg/sub/b.go", hunk("func (c *Client) Charlie()")),
+			},
+			want: "Update Alpha, Bravo and 1 more in pkg",
+		},
+		{
+			name:  "short symbols are ignored",
+			files: []diff.FileDiff{file("a.go", hunk("func Run()")), file("b.go", hunk("var x"))},
+			want:  "Update a.go and b.go",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var hunks []GroupedHunk
+			for i := range tt.files {
+				f := &tt.files[i]
+				for j := range f.Hunks {
+					hunks = append(hunks, GroupedHunk{File: f, Hunk: &f.Hunks[j]})
+				}
+			}
+			if got := heuristicTitle(hunks); got != tt.want {
+				t.Errorf("heuristicTitle = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
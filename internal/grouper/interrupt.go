@@ -0,0 +1,61 @@
+package grouper
+
+import (
+	"context"
+	"errors"
+)
+
+var ErrInterrupted = errors.New("analysis interrupted")
+
+type interruptKey struct{}
+
+// WithInterrupt makes the grouper stop waiting for the model once ch is
+// closed and show heuristic grouping instead.
+func WithInterrupt(ctx context.Context, ch <-chan struct{}) context.Context {
+	return context.WithValue(ctx, interruptKey{}, ch)
+}
+
+// interrupted reports whether the channel given to WithInterrupt is closed.
+func interrupted(ctx context.Context) bool {
+	ch, ok := ctx.Value(interruptKey{}).(<-chan struct{})
+	if !ok {
+		return false
+	}
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+func analysisContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	if ch, ok := ctx.Value(interruptKey{}).(<-chan struct{}); ok {
+		go func() {
+			select {
+			case <-ch:
+				cancel(ErrInterrupted)
+			case <-ctx.Done():
+			}
+		}()
+	}
+	return ctx, func() { cancel(nil) }
+}
+
+// aiFailed records why the model could not be used. It returns an error
+// only when the whole run was cancelled, as opposed to the analysis being
+// interrupted in favor of heuristic grouping, which may also happen while
+// a cancelled run is winding down.
+func (g *Grouper) aiFailed(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		if !interrupted(ctx) && !errors.Is(context.Cause(ctx), ErrInterrupted) {
+			return ctx.Err()
+		}
+		err = ErrInterrupted
+	}
+	g.mu.Lock()
+	g.report.Err = err
+	g.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,98 @@
+package grouper
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/jm/hnk/internal/diff"
+	"github.com/jm/hnk/internal/git"
+)
+
+// Commit is one commit of a log with the groups of its diff.
+type Commit struct {
+	git.Commit
+	Groups []SemanticGroup
+}
+
+// Ref names the i-th commit of a log by its short SHA, or as "patch N"
+// when it came from a patch without one.
+func (c *Commit) Ref(i int) string {
+	if c.SHA == "" {
+		return fmt.Sprintf("patch %d", i+1)
+	}
+	return c.ShortSHA()
+}
+
+// GroupCommit groups the diff of a single commit. The analysis is cached
+// under the commit's SHA.
+func (g *Grouper) GroupCommit(ctx context.Context, sha string, d *diff.Diff) ([]SemanticGroup, error) {
+	groups, err := g.group(ctx, d, sha, nil, nil)
+	return g.flagged(groups), err
+}
+
+type LogSummary struct {
+	Commits int
+	Groups  int
+	Hunks   int
+	Files   int
+	// Churn lists the files changed by more than one commit.
+	Churn []FileChurn
+	// Attention lists the groups that need attention, by commit.
+	Attention []CommitGroup
+}
+
+type FileChurn struct {
+	Path    string
+	Commits []string
+}
+
+type CommitGroup struct {
+	Ref   string
+	Group SemanticGroup
+}
+
+// Summarize describes a log as a whole: its size, the files several
+// commits touched and the groups a reviewer should look at first.
+func Summarize(commits []Commit) LogSummary {
+	s := LogSummary{Commits: len(commits)}
+	touched := make(map[string][]string)
+	var paths []string
+
+	for ci, c := range commits {
+		seen := make(map[string]bool)
+		for i := range c.Groups {
+			group := c.Groups[i]
+			s.Groups++
+			if flagged, ok := Flagged(group); ok {
+				s.Attention = append(s.Attention, CommitGroup{Ref: c.Ref(ci), Group: flagged})
+			}
+			for _, gh := range group.AllHunks() {
+				s.Hunks++
+				path := gh.File.NewPath
+				if gh.File.IsDeleted {
+					path = gh.File.OldPath
+				}
+				if seen[path] {
+					continue
+				}
+				seen[path] = true
+				if _, ok := touched[path]; !ok {
+					paths = append(paths, path)
+				}
+				touched[path] = append(touched[path], c.Ref(ci))
+			}
+		}
+	}
+
+	s.Files = len(paths)
+	for _, path := range paths {
+		if len(touched[path]) > 1 {
+			s.Churn = append(s.Churn, FileChurn{Path: path, Commits: touched[path]})
+		}
+	}
+	sort.SliceStable(s.Churn, func(i, j int) bool {
+		return len(s.Churn[i].Commits) > len(s.Churn[j].Commits)
+	})
+	return s
+}
@@ -0,0 +1,159 @@
+package grouper
+
+import (
+	"sort"
+
+	"github.com/jm/hnk/internal/diff"
+)
+
+const (
+	OrderAI   = "ai"
+	OrderFile = "file"
+)
+
+// sequencer releases groups in reading order: a group is held back until
+// every group it depends on has been released.
+type sequencer struct {
+	emit     func(SemanticGroup)
+	released map[string]string
+	pending  []SemanticGroup
+}
+
+func newSequencer(emit func(SemanticGroup)) *sequencer {
+	return &sequencer{emit: emit, released: make(map[string]string)}
+}
+
+func (s *sequencer) add(group SemanticGroup) {
+	group.Children = sortByDependencies(group.Children)
+	s.pending = append(s.pending, group)
+	s.release(false)
+}
+
+func (s *sequencer) finish() {
+	s.release(true)
+}
+
+func (s *sequencer) release(final bool) {
+	for len(s.pending) > 0 {
+		i := s.next(final)
+		if i < 0 {
+			return
+		}
+		group := s.pending[i]
+		s.pending = append(s.pending[:i], s.pending[i+1:]...)
+
+		group.BuildsOn = nil
+		for _, dep := range group.dependsOn {
+			if title, ok := s.released[dep]; ok {
+				group.BuildsOn = append(group.BuildsOn, title)
+			}
+		}
+		if group.id != "" {
+			s.released[group.id] = group.Title
+		}
+		s.emit(group)
+	}
+}
+
+func (s *sequencer) next(final bool) int {
+	for i := range s.pending {
+		if s.ready(&s.pending[i], final) {
+			return i
+		}
+	}
+	if final {
+		// Only a dependency cycle gets here; keep the model's order.
+		return 0
+	}
+	return -1
+}
+
+func (s *sequencer) ready(group *SemanticGroup, final bool) bool {
+	for _, dep := range group.dependsOn {
+		if _, ok := s.released[dep]; ok || dep == group.id {
+			continue
+		}
+		if final && !s.isPending(dep) {
+			continue
+		}
+		return false
+	}
+	return true
+}
+
+func (s *sequencer) isPending(id string) bool {
+	for _, g := range s.pending {
+		if g.id == id {
+			return true
+		}
+	}
+	return false
+}
+
+func sortByDependencies(groups []SemanticGroup) []SemanticGroup {
+	if len(groups) == 0 {
+		return groups
+	}
+	sorted := make([]SemanticGroup, 0, len(groups))
+	s := newSequencer(func(group SemanticGroup) {
+		sorted = append(sorted, group)
+	})
+	for _, group := range groups {
+		s.add(group)
+	}
+	s.finish()
+	return sorted
+}
+
+func sortByPosition(d *diff.Diff, groups []SemanticGroup) []SemanticGroup {
+	fileIndex := make(map[*diff.FileDiff]int)
+	for i := range d.Files {
+		fileIndex[&d.Files[i]] = i
+	}
+
+	var sortLevel func(groups []SemanticGroup)
+	sortLevel = func(groups []SemanticGroup) {
+		titles := make(map[string]string)
+		for _, g := range groups {
+			if g.id != "" {
+				titles[g.id] = g.Title
+			}
+		}
+		for i := range groups {
+			groups[i].BuildsOn = nil
+			for _, dep := range groups[i].dependsOn {
+				if title, ok := titles[dep]; ok && dep != groups[i].id {
+					groups[i].BuildsOn = append(groups[i].BuildsOn, title)
+				}
+			}
+			sortLevel(groups[i].Children)
+		}
+
+		sort.SliceStable(groups, func(i, j int) bool {
+			fi, li := firstPosition(fileIndex, &groups[i])
+			fj, lj := firstPosition(fileIndex, &groups[j])
+			if fi != fj {
+				return fi < fj
+			}
+			return li < lj
+		})
+	}
+
+	sorted := append([]SemanticGroup(nil), groups...)
+	sortLevel(sorted)
+	return sorted
+}
+
+func firstPosition(fileIndex map[*diff.FileDiff]int, group *SemanticGroup) (int, int) {
+	file, line := len(fileIndex), 0
+	for _, gh := range group.AllHunks() {
+		idx, ok := fileIndex[gh.File]
+		if !ok {
+			continue
+		}
+		if idx < file || (idx == file && gh.Hunk.OldStart < line) {
+			file, line = idx, gh.Hunk.OldStart
+		}
+	}
+	return file, line
+}
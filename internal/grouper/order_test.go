@@ -0,0 +1,105 @@
+package grouper
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func group(id, title string, dependsOn ...string) SemanticGroup {
+	return SemanticGroup{Title: title, id: id, dependsOn: dependsOn}
+}
+
+func TestSequencer(t *testing.T) {
+	tests := []struct {
+		name   string
+		groups []SemanticGroup
+		// steps lists the titles released after each group is added, and
+		// then by finish.
+		steps    []string
+		buildsOn map[string][]string
+	}{
+		{
+			name:   "independent groups in arrival order",
+			groups: []SemanticGroup{group("a", "A"), group("b", "B"), group("c", "C")},
+			steps:  []string{"A", "B", "C", ""},
+		},
+		{
+			name:     "held back until its dependency arrives",
+			groups:   []SemanticGroup{group("b", "B", "a"), group("c", "C"), group("a", "A")},
+			steps:    []string{"", "C", "A B", ""},
+			buildsOn: map[string][]string{"B": {"A"}},
+		},
+		{
+			name:     "chain released at once",
+			groups:   []SemanticGroup{group("c", "C", "b"), group("b", "B", "a"), group("a", "A")},
+			steps:    []string{"", "", "A B C", ""},
+			buildsOn: map[string][]string{"B": {"A"}, "C": {"B"}},
+		},
+		{
+			name:   "unknown dependency waits for finish",
+			groups: []SemanticGroup{group("a", "A", "zzz"), group("b", "B")},
+			steps:  []string{"", "B", "A"},
+		},
+		{
+			name:     "cycle keeps the model's order",
+			groups:   []SemanticGroup{group("a", "A", "b"), group("b", "B", "a")},
+			steps:    []string{"", "", "A B"},
+			buildsOn: map[string][]string{"B": {"A"}},
+		},
+		{
+			name:   "self dependency",
+			groups: []SemanticGroup{group("a", "A", "a")},
+			steps:  []string{"A", ""},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var released []string
+			buildsOn := make(map[string][]string)
+			s := newSequencer(func(g SemanticGroup) {
+				released = append(released, g.Title)
+				if len(g.BuildsOn) > 0 {
+					buildsOn[g.Title] = g.BuildsOn
+				}
+			})
+
+			var steps []string
+			step := func() {
+				steps = append(steps, strings.Join(released, " "))
+				released = nil
+			}
+			for _, g := range tt.groups {
+				s.add(g)
+				step()
+			}
+			s.finish()
+			step()
+
+			if !reflect.DeepEqual(steps, tt.steps) {
+				t.Errorf("released %q, want %q", steps, tt.steps)
+			}
+			if tt.buildsOn == nil {
+				tt.buildsOn = map[string][]string{}
+			}
+			if !reflect.DeepEqual(buildsOn, tt.buildsOn) {
+				t.Errorf("BuildsOn = %v, want %v", buildsOn, tt.buildsOn)
+			}
+		})
+	}
+}
+
+func TestSortByDependenciesChildren(t *testing.T) {
+	parent := group("p", "P")
+	parent.Children = []SemanticGroup{group("y", "Y", "x"), group("x", "X")}
+
+	sorted := sortByDependencies([]SemanticGroup{parent})
+	var titles []string
+	for _, c := range sorted[0].Children {
+		titles = append(titles, c.Title)
+	}
+	if want := []string{"X", "Y"}; !reflect.DeepEqual(titles, want) {
+		t.Errorf("children = %v, want %v", titles, want)
+	}
+}
@@ -0,0 +1,79 @@
+package grouper
+
+import (
+	"fmt"
+
+	"github.com/jm/hnk/internal/diff"
+)
+
+const lowConfidence = 0.5
+
+// LowConfidence reports whether the model said it was unsure of the group.
+// A confidence of 0 means the model gave none.
+func (g *SemanticGroup) LowConfidence() bool {
+	return g.Confidence > 0 && g.Confidence < lowConfidence
+}
+
+// NeedsAttention reports whether the group or any of its sub-groups has
+// concerns or low confidence.
+func (g *SemanticGroup) NeedsAttention() bool {
+	if len(g.Concerns) > 0 || g.LowConfidence() {
+		return true
+	}
+	for i := range g.Children {
+		if g.Children[i].NeedsAttention() {
+			return true
+		}
+	}
+	return false
+}
+
+// Flagged trims group down to what needs attention. A theme that is not
+// flagged itself keeps only its flagged sub-groups.
+func Flagged(group SemanticGroup) (SemanticGroup, bool) {
+	if len(group.Concerns) > 0 || group.LowConfidence() {
+		return group, true
+	}
+	var children []SemanticGroup
+	for _, child := range group.Children {
+		if c, ok := Flagged(child); ok {
+			children = append(children, c)
+		}
+	}
+	group.Children = children
+	return group, len(children) > 0
+}
+
+func (g *Grouper) flagged(groups []SemanticGroup) []SemanticGroup {
+	if !g.concernsOnly {
+		return groups
+	}
+	var kept []SemanticGroup
+	for _, group := range groups {
+		if group, ok := Flagged(group); ok {
+			kept = append(kept, group)
+		}
+	}
+	return kept
+}
+
+// Badges summarizes the model's confidence, the index status of the
+// group's hunks and its concerns for display, e.g. "confidence 40%",
+// "partly staged" and "2 concerns".
+func (g *SemanticGroup) Badges() []string {
+	var badges []string
+	if g.Confidence > 0 {
+		badges = append(badges, fmt.Sprintf("confidence %.0f%%", g.Confidence*100))
+	}
+	var stage diff.Stage
+	for _, gh := range g.AllHunks() {
+		stage |= gh.Stage()
+	}
+	if stage != 0 {
+		badges = append(badges, stage.String())
+	}
+	if n := len(g.Concerns); n > 0 {
+		badges = append(badges, Plural(n, "concern"))
+	}
+	return badges
+}
@@ -0,0 +1,252 @@
+package patch
+
+import (
+	"mime"
+	"regexp"
+	"strings"
+
+	"github.com/jm/hnk/internal/git"
+)
+
+// Patch is one commit's worth of a patch series or log. Commit is empty
+// when the input was a bare diff.
+type Patch struct {
+	git.Commit
+	Diff string
+}
+
+var (
+	ansiRe      = regexp.MustCompile(`\x1b\[[0-9;?]*[A-Za-z]`)
+	mboxFromRe  = regexp.MustCompile(`^From (\S+) `)
+	headerRe    = regexp.MustCompile(`^([A-Za-z-]+): ?(.*)$`)
+	logCommitRe = regexp.MustCompile(`^commit ([0-9a-f]{7,64})\b`)
+	subjectTag  = regexp.MustCompile(`^(?:\[[^\]]*\]\s*)+`)
+	emailRe     = regexp.MustCompile(`\s*<[^>]*>$`)
+	plainOldRe  = regexp.MustCompile(`^--- (\S+)`)
+	plainNewRe  = regexp.MustCompile(`^\+\+\+ (\S+)`)
+	fullSHARe   = regexp.MustCompile(`^[0-9a-f]{40}$`)
+)
+
+// Clean removes colors and carriage returns, as in the output of a git
+// command that is paging through hnk.
+func Clean(input string) string {
+	input = ansiRe.ReplaceAllString(input, "")
+	return strings.ReplaceAll(input, "\r\n", "\n")
+}
+
+// Split breaks input into patches: the mails of an mbox or git
+// format-patch series, the commits of git log -p or git show, or a single
+// bare diff. Mail signatures and everything around the diffs are dropped.
+// Patches without a diff, like a series' cover letter, are skipped.
+func Split(input string) []Patch {
+	lines := strings.Split(input, "\n")
+
+	var starts []int
+	for i, line := range lines {
+		if isMailStart(lines, i) || logCommitRe.MatchString(line) {
+			starts = append(starts, i)
+		}
+	}
+	if len(starts) == 0 {
+		return []Patch{{Diff: withGitHeaders(lines)}}
+	}
+
+	var patches []Patch
+	for i, start := range starts {
+		end := len(lines)
+		if i+1 < len(starts) {
+			end = starts[i+1]
+		}
+		var p Patch
+		if logCommitRe.MatchString(lines[start]) {
+			p = parseLogEntry(lines[start:end])
+		} else {
+			p = parseMail(lines[start:end])
+		}
+		if p.Diff != "" {
+			patches = append(patches, p)
+		}
+	}
+	return patches
+}
+
+func isMailStart(lines []string, i int) bool {
+	return mboxFromRe.MatchString(lines[i]) && i+1 < len(lines) && headerRe.MatchString(lines[i+1])
+}
+
+func parseMail(lines []string) Patch {
+	var p Patch
+	if sha := mboxFromRe.FindStringSubmatch(lines[0])[1]; fullSHARe.MatchString(sha) && strings.Trim(sha, "0") != "" {
+		p.SHA = sha
+	}
+
+	i := 1
+	last := ""
+	for ; i < len(lines) && lines[i] != ""; i++ {
+		line := lines[i]
+		// Folded header lines continue the previous header.
+		if strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t") {
+			if last == "Subject" {
+				p.Subject += " " + strings.TrimSpace(line)
+			}
+			continue
+		}
+		m := headerRe.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		last = m[1]
+		switch m[1] {
+		case "From":
+			p.Author = strings.Trim(emailRe.ReplaceAllString(decodeHeader(m[2]), ""), `"`)
+		case "Date":
+			p.Date = m[2]
+		case "Subject":
+			p.Subject = m[2]
+		}
+	}
+	p.Subject = subjectTag.ReplaceAllString(decodeHeader(p.Subject), "")
+
+	// The message ends at the "---" line above the diffstat, or at the diff
+	// itself when there is none.
+	var body []string
+	for ; i < len(lines) && lines[i] != "---" && !isDiffStart(lines, i); i++ {
+		body = append(body, lines[i])
+	}
+	p.Body = strings.TrimSpace(strings.Join(body, "\n"))
+	p.Diff = diffFrom(lines[i:])
+	return p
+}
+
+// decodeHeader decodes the =?UTF-8?q?...?= words git uses for non-ASCII
+// names and subjects.
+func decodeHeader(s string) string {
+	if decoded, err := new(mime.WordDecoder).DecodeHeader(s); err == nil {
+		return decoded
+	}
+	return s
+}
+
+func parseLogEntry(lines []string) Patch {
+	p := Patch{}
+	p.SHA = logCommitRe.FindStringSubmatch(lines[0])[1]
+
+	i := 1
+	for ; i < len(lines) && lines[i] != ""; i++ {
+		m := headerRe.FindStringSubmatch(lines[i])
+		if m == nil {
+			continue
+		}
+		switch m[1] {
+		case "Author":
+			p.Author = emailRe.ReplaceAllString(strings.TrimSpace(m[2]), "")
+		case "Date":
+			p.Date = strings.TrimSpace(m[2])
+		}
+	}
+
+	// The message is indented by four spaces; a diffstat may follow it.
+	var message []string
+	for ; i < len(lines) && !isDiffStart(lines, i); i++ {
+		if text, ok := strings.CutPrefix(lines[i], "    "); ok {
+			message = append(message, text)
+		} else if lines[i] == "" && len(message) > 0 {
+			message = append(message, "")
+		}
+	}
+	subject, body, _ := strings.Cut(strings.TrimSpace(strings.Join(message, "\n")), "\n")
+	p.Subject = subject
+	p.Body = strings.TrimSpace(body)
+	p.Diff = diffFrom(lines[i:])
+	return p
+}
+
+// diffFrom returns the diff at the start of lines, without a trailing
+// mail signature.
+func diffFrom(lines []string) string {
+	start := 0
+	for start < len(lines) && !isDiffStart(lines, start) {
+		start++
+	}
+	lines = lines[start:]
+	for i, line := range lines {
+		if line == "-- " {
+			lines = lines[:i]
+			break
+		}
+	}
+	return withGitHeaders(lines)
+}
+
+func isDiffStart(lines []string, i int) bool {
+	return isGitHeader(lines[i]) || isPlainHeader(lines, i)
+}
+
+func isGitHeader(line string) bool {
+	return strings.HasPrefix(line, "diff --git ") || strings.HasPrefix(line, "diff --cc ") || strings.HasPrefix(line, "diff --combined ")
+}
+
+// isPlainHeader reports whether a "---" line starts a file in a diff
+// without git's "diff --git" lines, like the output of diff -u.
+func isPlainHeader(lines []string, i int) bool {
+	return plainOldRe.MatchString(lines[i]) && i+2 < len(lines) &&
+		plainNewRe.MatchString(lines[i+1]) && strings.HasPrefix(lines[i+2], "@@ ")
+}
+
+// withGitHeaders joins lines into a diff. Files that only have "---" and
+// "+++" lines get git's headers, without timestamps, so the parser sees
+// them.
+func withGitHeaders(lines []string) string {
+	var sb strings.Builder
+	gitHeader := false
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		switch {
+		case isGitHeader(line):
+			gitHeader = true
+		case strings.HasPrefix(line, "@@"):
+			gitHeader = false
+		case !gitHeader && isPlainHeader(lines, i):
+			oldPath := plainOldRe.FindStringSubmatch(line)[1]
+			newPath := plainNewRe.FindStringSubmatch(lines[i+1])[1]
+			oldPath, newPath = stripDirs(oldPath, newPath)
+			a, b := gitPath(oldPath, newPath, "a/"), gitPath(newPath, oldPath, "b/")
+			sb.WriteString("diff --git " + a + " " + b + "\n")
+			switch {
+			case oldPath == "/dev/null":
+				sb.WriteString("new file mode 100644\n--- /dev/null\n+++ " + b + "\n")
+			case newPath == "/dev/null":
+				sb.WriteString("deleted file mode 100644\n--- " + a + "\n+++ /dev/null\n")
+			default:
+				sb.WriteString("--- " + a + "\n+++ " + b + "\n")
+			}
+			i++
+			continue
+		}
+		sb.WriteString(line + "\n")
+	}
+	return sb.String()
+}
+
+// stripDirs removes the top directories of diff -ru old new, like
+// patch -p1 does, when the rest of both paths is the same.
+func stripDirs(oldPath, newPath string) (string, string) {
+	_, oldRest, ok1 := strings.Cut(oldPath, "/")
+	_, newRest, ok2 := strings.Cut(newPath, "/")
+	if ok1 && ok2 && oldRest == newRest {
+		return oldRest, newRest
+	}
+	return oldPath, newPath
+}
+
+// gitPath turns a path from a "---" or "+++" line into the form of a
+// "diff --git" line, taking the other side's path for /dev/null.
+func gitPath(path, other, prefix string) string {
+	if path == "/dev/null" {
+		path = other
+	}
+	if !strings.HasPrefix(path, prefix) {
+		path = prefix + strings.TrimPrefix(strings.TrimPrefix(path, "a/"), "b/")
+	}
+	return path
+}
@@ -0,0 +1,157 @@
+package patch
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/jm/hnk/internal/git"
+)
+
+const (
+	sha1 = "254ed4e137e549de46d8e70dd2ce39c5aa6af904"
+	sha2 = "d9c0af8fe784a383e3a023379b9a851fc8337781"
+)
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []Patch
+	}{
+		{
+			name: "mbox series with a cover letter",
+			input: `From 0000000000000000000000000000000000000000 Mon Sep 17 00:00:00 2001
+From: Ann <a@b>
+Date: Fri, 16 Oct 2026 08:46:49 +0000
+Subject: [PATCH 0/2] Cover
+
+Two small changes.
+
+From ` + sha1 + ` Mon Sep 17 00:00:00 2001
+From: =?UTF-8?q?J=C3=B6rg?= <j@b>
+Date: Fri, 16 Oct 2026 08:46:49 +0000
+Subject: [PATCH v2 1/2] Change a
+ across two lines
+
+Why a changes.
+
+---
+ x.go | 2 +-
+ 1 file changed, 1 insertion(+), 1 deletion(-)
+
+diff --git a/x.go b/x.go
+index 1175f1b..13352b6 100644
+--- a/x.go
++++ b/x.go
+@@ -1 +1 @@
+-var a = 1
++var a = 2
+-- 
+2.39.5
+
+From ` + sha2 + ` Mon Sep 17 00:00:00 2001
+From: "Ann" <a@b>
+Date: Fri, 16 Oct 2026 08:46:50 +0000
+Subject: [PATCH v2 2/2] Add y
+
+diff --git a/y.txt b/y.txt
+new file mode 100644
+--- /dev/null
++++ b/y.txt
+@@ -0,0 +1 @@
++hello
+-- 
+2.39.5
+`,
+			want: []Patch{
+				{
+					Commit: git.Commit{SHA: sha1, Author: "Jörg", Date: "Fri, 16 Oct 2026 08:46:49 +0000", Subject: "Change a across two lines", Body: "Why a changes."},
+					Diff:   "diff --git a/x.go b/x.go\nindex 1175f1b..13352b6 100644\n--- a/x.go\n+++ b/x.go\n@@ -1 +1 @@\n-var a = 1\n+var a = 2\n",
+				},
+				{
+					Commit: git.Commit{SHA: sha2, Author: "Ann", Date: "Fri, 16 Oct 2026 08:46:50 +0000", Subject: "Add y"},
+					Diff:   "diff --git a/y.txt b/y.txt\nnew file mode 100644\n--- /dev/null\n+++ b/y.txt\n@@ -0,0 +1 @@\n+hello\n",
+				},
+			},
+		},
+		{
+			name: "format-patch without a SHA",
+			input: `From 0000000000000000000000000000000000000000 Mon Sep 17 00:00:00 2001
+From: Ann <a@b>
+Subject: [PATCH] Change a
+
+---
+ x.go | 2 +-
+
+diff --git a/x.go b/x.go
+--- a/x.go
++++ b/x.go
+@@ -1 +1 @@
+-var a = 1
++var a = 2
+`,
+			want: []Patch{{
+				Commit: git.Commit{Author: "Ann", Subject: "Change a"},
+				Diff:   "diff --git a/x.go b/x.go\n--- a/x.go\n+++ b/x.go\n@@ -1 +1 @@\n-var a = 1\n+var a = 2\n\n",
+			}},
+		},
+		{
+			name: "git log -p",
+			input: `commit ` + sha1 + ` (HEAD -> main)
+Author: Ann <a@b>
+Date:   Fri Oct 16 08:46:49 2026 +0000
+
+    Change a
+
+    Why a changes.
+
+diff --git a/x.go b/x.go
+--- a/x.go
++++ b/x.go
+@@ -1 +1 @@
+-var a = 1
++var a = 2
+
+commit ` + sha2 + `
+Author: Ann <a@b>
+Date:   Fri Oct 16 08:46:50 2026 +0000
+
+    Only a message
+`,
+			want: []Patch{{
+				Commit: git.Commit{SHA: sha1, Author: "Ann", Date: "Fri Oct 16 08:46:49 2026 +0000", Subject: "Change a", Body: "Why a changes."},
+				Diff:   "diff --git a/x.go b/x.go\n--- a/x.go\n+++ b/x.go\n@@ -1 +1 @@\n-var a = 1\n+var a = 2\n\n",
+			}},
+		},
+		{
+			name: "diff -ru",
+			input: `diff -ru old/x.go new/x.go
+--- old/x.go	2026-10-16 08:46:49.000000000 +0000
++++ new/x.go	2026-10-16 08:46:50.000000000 +0000
+@@ -1 +1 @@
+-var a = 1
++var a = 2
+`,
+			want: []Patch{{
+				Diff: "diff -ru old/x.go new/x.go\ndiff --git a/x.go b/x.go\n--- a/x.go\n+++ b/x.go\n@@ -1 +1 @@\n-var a = 1\n+var a = 2\n\n",
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Split(tt.input)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Split =\n%#v\nwant\n%#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClean(t *testing.T) {
+	input := "\x1b[1mdiff --git a/x.go b/x.go\x1b[m\r\n\x1b[32m+var a = 2\x1b[m\r\n"
+	want := "diff --git a/x.go b/x.go\n+var a = 2\n"
+	if got := Clean(input); got != want {
+		t.Errorf("Clean = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,76 @@
+package pool
+
+import (
+	"context"
+	"sync"
+)
+
+const DefaultLimit = 4
+
+type Progress func(done, total int)
+
+// Map runs fn over items with at most limit calls in flight and returns the
+// results in input order. The first error cancels the remaining work and is
+// returned once the running calls have finished.
+func Map[T, R any](ctx context.Context, limit int, items []T, fn func(ctx context.Context, item T) (R, error), progress Progress) ([]R, error) {
+	if limit <= 0 {
+		limit = DefaultLimit
+	}
+	results := make([]R, len(items))
+	if len(items) == 0 {
+		return results, nil
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+		done     int
+	)
+	sem := make(chan struct{}, limit)
+
+	for i, item := range items {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			result, err := fn(ctx, item)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				if firstErr == nil {
+					firstErr = err
+					cancel()
+				}
+				return
+			}
+			results[i] = result
+			done++
+			if progress != nil {
+				progress(done, len(items))
+			}
+		}()
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
@@ -0,0 +1,128 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMapOrder(t *testing.T) {
+	items := []int{5, 4, 3, 2, 1, 0}
+	var mu sync.Mutex
+	var progress [][2]int
+
+	// Later items finish first, but the results keep the input order.
+	got, err := Map(context.Background(), 3, items, func(ctx context.Context, n int) (int, error) {
+		time.Sleep(time.Duration(n) * time.Millisecond)
+		return n * n, nil
+	}, func(done, total int) {
+		mu.Lock()
+		defer mu.Unlock()
+		progress = append(progress, [2]int{done, total})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int{25, 16, 9, 4, 1, 0}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Map = %v, want %v", got, want)
+	}
+	if want := [][2]int{{1, 6}, {2, 6}, {3, 6}, {4, 6}, {5, 6}, {6, 6}}; !reflect.DeepEqual(progress, want) {
+		t.Errorf("progress = %v, want %v", progress, want)
+	}
+
+	got, err = Map(context.Background(), 3, nil, func(ctx context.Context, n int) (int, error) {
+		t.Error("fn called without items")
+		return 0, nil
+	}, nil)
+	if err != nil || len(got) != 0 {
+		t.Errorf("Map of no items = %v, %v", got, err)
+	}
+}
+
+func TestMapLimit(t *testing.T) {
+	tests := []struct {
+		limit int
+		want  int
+	}{
+		{limit: 1, want: 1},
+		{limit: 3, want: 3},
+		{limit: 0, want: DefaultLimit},
+	}
+
+	for _, tt := range tests {
+		var running, peak atomic.Int32
+		_, err := Map(context.Background(), tt.limit, make([]int, 12), func(ctx context.Context, _ int) (int, error) {
+			n := running.Add(1)
+			defer running.Add(-1)
+			for {
+				p := peak.Load()
+				if n <= p || peak.CompareAndSwap(p, n) {
+					break
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+			return 0, nil
+		}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := int(peak.Load()); got > tt.want || (tt.want > 1 && got < 2) {
+			t.Errorf("limit %d: %d calls ran at once, want at most %d", tt.limit, got, tt.want)
+		}
+	}
+}
+
+func TestMapError(t *testing.T) {
+	failed := errors.New("batch 2 failed")
+	var calls atomic.Int32
+	var cancelled atomic.Int32
+
+	_, err := Map(context.Background(), 2, make([]int, 20), func(ctx context.Context, _ int) (int, error) {
+		if calls.Add(1) == 2 {
+			return 0, failed
+		}
+		select {
+		case <-ctx.Done():
+			cancelled.Add(1)
+			return 0, ctx.Err()
+		case <-time.After(5 * time.Second):
+			return 0, nil
+		}
+	}, nil)
+	if err != failed {
+		t.Errorf("err = %v, want %v", err, failed)
+	}
+	if cancelled.Load() == 0 {
+		t.Error("the running call was not cancelled")
+	}
+	if n := calls.Load(); n > 3 {
+		t.Errorf("%d calls started after the error, want the rest skipped", n-2)
+	}
+}
+
+func TestMapCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var calls atomic.Int32
+
+	start := time.Now()
+	_, err := Map(ctx, 2, make([]int, 10), func(ctx context.Context, _ int) (int, error) {
+		if calls.Add(1) == 2 {
+			cancel()
+		}
+		<-ctx.Done()
+		return 0, nil
+	}, nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want %v", err, context.Canceled)
+	}
+	if n := calls.Load(); n != 2 {
+		t.Errorf("%d calls started, want 2", n)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("Map took %s to return after the cancel", d)
+	}
+}
@@ -0,0 +1,116 @@
+package render
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jm/hnk/internal/grouper"
+)
+
+// RenderCommit prints a commit's header, message and groups as one section
+// of a log.
+func (r *Renderer) RenderCommit(index int, c grouper.Commit) error {
+	if index > 0 {
+		fmt.Fprintln(r.out)
+	}
+	rule := strings.Repeat("━", 80)
+	if r.useColor {
+		fmt.Fprintf(r.out, "%s%s%s\n", r.theme.lineNum, rule, colorReset)
+		fmt.Fprintf(r.out, "%s%s%s %s%s, %s%s\n", colorMagenta, commitLabel(index, &c), colorReset, r.theme.desc, c.Author, c.Date, colorReset)
+		fmt.Fprintf(r.out, "%s%s%s\n", colorBold, c.Subject, colorReset)
+		if c.Body != "" {
+			fmt.Fprintf(r.out, "\n%s%s%s\n", r.theme.desc, c.Body, colorReset)
+		}
+		fmt.Fprintf(r.out, "%s%s%s\n", r.theme.lineNum, rule, colorReset)
+	} else {
+		fmt.Fprintln(r.out, strings.Repeat("=", 80))
+		fmt.Fprintf(r.out, "%s %s, %s\n", commitLabel(index, &c), c.Author, c.Date)
+		fmt.Fprintln(r.out, c.Subject)
+		if c.Body != "" {
+			fmt.Fprintf(r.out, "\n%s\n", c.Body)
+		}
+		fmt.Fprintln(r.out, strings.Repeat("=", 80))
+	}
+
+	if len(c.Groups) == 0 {
+		fmt.Fprintln(r.out, "\nNo changes to display")
+		return nil
+	}
+	return r.RenderGroups(c.Groups)
+}
+
+func commitLabel(index int, c *grouper.Commit) string {
+	if c.SHA == "" {
+		return c.Ref(index)
+	}
+	return "commit " + c.ShortSHA()
+}
+
+func (r *Renderer) RenderRawCommit(index int, c grouper.Commit) error {
+	if index > 0 {
+		fmt.Fprintln(r.out, "===")
+		fmt.Fprintln(r.out)
+	}
+	if c.SHA != "" {
+		fmt.Fprintf(r.out, "commit %s\n", c.SHA)
+	}
+	fmt.Fprintf(r.out, "Author: %s\nDate: %s\n\n%s\n\n", c.Author, c.Date, c.Subject)
+	if c.Body != "" {
+		fmt.Fprintf(r.out, "%s\n\n", c.Body)
+	}
+	return r.RenderRaw(c.Groups)
+}
+
+// RenderLogSummary prints what a log adds up to across its commits.
+func (r *Renderer) RenderLogSummary(s grouper.LogSummary) {
+	r.writeDivider()
+	r.heading("Summary")
+	fmt.Fprintf(r.out, "%s, %s, %s in %s\n",
+		grouper.Plural(s.Commits, "commit"), grouper.Plural(s.Groups, "group"), grouper.Plural(s.Hunks, "hunk"), grouper.Plural(s.Files, "file"))
+
+	if len(s.Churn) > 0 {
+		fmt.Fprintln(r.out)
+		r.heading("Changed in several commits")
+		for _, f := range s.Churn {
+			fmt.Fprintf(r.out, "  %s (%s)\n", f.Path, strings.Join(f.Commits, ", "))
+		}
+	}
+
+	if len(s.Attention) > 0 {
+		fmt.Fprintln(r.out)
+		r.heading("Needs attention")
+		for _, cg := range s.Attention {
+			fmt.Fprintf(r.out, "  %s %s\n", cg.Ref, cg.Group.Title)
+			r.writeAttention(&cg.Group, "    ")
+		}
+	}
+}
+
+func (r *Renderer) writeAttention(group *grouper.SemanticGroup, indent string) {
+	for _, c := range group.Concerns {
+		r.warning(indent + "! " + c)
+	}
+	if group.LowConfidence() {
+		r.warning(fmt.Sprintf("%s! low confidence (%.0f%%)", indent, group.Confidence*100))
+	}
+	for i := range group.Children {
+		fmt.Fprintf(r.out, "%s%s\n", indent, group.Children[i].Title)
+		r.writeAttention(&group.Children[i], indent+"  ")
+	}
+}
+
+func (r *Renderer) heading(s string) {
+	if r.useColor {
+		fmt.Fprintf(r.out, "%s%s%s\n", r.theme.title, s, colorReset)
+	} else {
+		fmt.Fprintln(r.out, s)
+	}
+}
+
+func (r *Renderer) warning(s string) {
+	if r.useColor {
+		fmt.Fprintf(r.out, "%s%s%s\n", r.theme.warn, s, colorReset)
+	} else {
+		fmt.Fprintln(r.out, s)
+	}
+}
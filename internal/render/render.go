@@ -27,6 +27,7 @@ type theme struct {
 	desc       string
 	file       string
 	lineNum    string
+	warn       string
 	chromaStyle string
 }
 
@@ -37,6 +38,7 @@ var darkTheme = theme{
 	desc:        "\033[2m",
 	file:        "\033[1m\033[34m",
 	lineNum:     "\033[2m",
+	warn:        "\033[1m\033[33m",
 	chromaStyle: "monokai",
 }
 
@@ -47,6 +49,7 @@ var lightTheme = theme{
 	desc:        "\033[90m",
 	file:        "\033[1m\033[35m",
 	lineNum:     "\033[90m",
+	warn:        "\033[1m\033[38;5;130m",
 	chromaStyle: "github",
 }
 
@@ -115,20 +118,40 @@ func New(out io.Writer, opts ...Option) *Renderer {
 
 func (r *Renderer) RenderGroups(groups []grouper.SemanticGroup) error {
 	for i, group := range groups {
-		if i > 0 {
-			r.writeDivider()
-		}
-		if err := r.renderGroup(&group); err != nil {
+		if err := r.RenderGroup(i, group); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
+func (r *Renderer) RenderGroup(index int, group grouper.SemanticGroup) error {
+	if index > 0 {
+		r.writeDivider()
+	}
+	return r.renderGroup(&group)
+}
+
 func (r *Renderer) renderGroup(group *grouper.SemanticGroup) error {
-	r.writeGroupHeader(group.Title, group.Description)
+	return r.renderNested(group, 0)
+}
+
+func (r *Renderer) renderNested(group *grouper.SemanticGroup, depth int) error {
+	r.writeGroupHeader(group, depth)
+	r.writeConcerns(group.Concerns, depth)
+	r.writeBuildsOn(group.BuildsOn, depth)
 
-	for _, gh := range group.Hunks {
+	if len(group.Children) > 0 {
+		r.writeOutline(group.Children, depth+1)
+		for i := range group.Children {
+			if err := r.renderNested(&group.Children[i], depth+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for _, gh := range group.Stitched() {
 		r.writeFileHeader(gh.File)
 		r.renderHunk(gh.File, gh.Hunk)
 	}
@@ -136,13 +159,60 @@ func (r *Renderer) renderGroup(group *grouper.SemanticGroup) error {
 	return nil
 }
 
-func (r *Renderer) writeGroupHeader(title, description string) {
+func (r *Renderer) writeGroupHeader(group *grouper.SemanticGroup, depth int) {
+	indent := strings.Repeat("  ", depth)
+	var badges string
+	for _, b := range group.Badges() {
+		badges += " [" + b + "]"
+	}
 	if r.useColor {
-		fmt.Fprintf(r.out, "\n%s%s%s\n", r.theme.title, title, colorReset)
-		fmt.Fprintf(r.out, "%s%s%s\n\n", r.theme.desc, description, colorReset)
+		badgeColor := r.theme.desc
+		if group.NeedsAttention() {
+			badgeColor = r.theme.warn
+		}
+		fmt.Fprintf(r.out, "\n%s%s%s%s%s%s%s\n", indent, r.theme.title, group.Title, colorReset, badgeColor, badges, colorReset)
+		fmt.Fprintf(r.out, "%s%s%s%s\n\n", indent, r.theme.desc, group.Description, colorReset)
 	} else {
-		fmt.Fprintf(r.out, "\n%s\n", title)
-		fmt.Fprintf(r.out, "%s\n\n", description)
+		fmt.Fprintf(r.out, "\n%s%s%s\n", indent, group.Title, badges)
+		fmt.Fprintf(r.out, "%s%s\n\n", indent, group.Description)
+	}
+}
+
+func (r *Renderer) writeConcerns(concerns []string, depth int) {
+	if len(concerns) == 0 {
+		return
+	}
+	indent := strings.Repeat("  ", depth)
+	for _, c := range concerns {
+		if r.useColor {
+			fmt.Fprintf(r.out, "%s%s! %s%s\n", indent, r.theme.warn, c, colorReset)
+		} else {
+			fmt.Fprintf(r.out, "%s! %s\n", indent, c)
+		}
+	}
+	fmt.Fprintln(r.out)
+}
+
+func (r *Renderer) writeBuildsOn(titles []string, depth int) {
+	if len(titles) == 0 {
+		return
+	}
+	line := strings.Repeat("  ", depth) + "builds on: " + strings.Join(titles, ", ")
+	if r.useColor {
+		fmt.Fprintf(r.out, "%s%s%s\n\n", r.theme.desc, line, colorReset)
+	} else {
+		fmt.Fprintf(r.out, "%s\n\n", line)
+	}
+}
+
+func (r *Renderer) writeOutline(children []grouper.SemanticGroup, depth int) {
+	indent := strings.Repeat("  ", depth)
+	for i, child := range children {
+		if r.useColor {
+			fmt.Fprintf(r.out, "%s%s%d. %s%s\n", indent, r.theme.desc, i+1, child.Title, colorReset)
+		} else {
+			fmt.Fprintf(r.out, "%s%d. %s\n", indent, i+1, child.Title)
+		}
 	}
 }
 
@@ -168,16 +238,23 @@ func (r *Renderer) writeFileHeader(f *diff.FileDiff) {
 
 func (r *Renderer) renderHunk(f *diff.FileDiff, h *diff.Hunk) {
 	if r.useColor {
-		header := fmt.Sprintf("@@ -%d,%d +%d,%d @@", h.OldStart, h.OldCount, h.NewStart, h.NewCount)
+		header := h.Range()
 		if h.Header != "" {
 			header += " " + h.Header
 		}
-		fmt.Fprintf(r.out, "%s%s%s\n", colorMagenta, header, colorReset)
+		fmt.Fprintf(r.out, "%s%s%s", colorMagenta, header, colorReset)
+		if stage := h.Stage(); stage != 0 {
+			fmt.Fprintf(r.out, " %s[%s]%s", r.theme.desc, stage, colorReset)
+		}
+		fmt.Fprintln(r.out)
 	} else {
-		fmt.Fprintf(r.out, "@@ -%d,%d +%d,%d @@", h.OldStart, h.OldCount, h.NewStart, h.NewCount)
+		fmt.Fprint(r.out, h.Range())
 		if h.Header != "" {
 			fmt.Fprintf(r.out, " %s", h.Header)
 		}
+		if stage := h.Stage(); stage != 0 {
+			fmt.Fprintf(r.out, " [%s]", stage)
+		}
 		fmt.Fprintln(r.out)
 	}
 
@@ -204,7 +281,7 @@ func (r *Renderer) renderLine(language string, line *diff.Line) {
 
 	switch line.Type {
 	case diff.LineAdded:
-		prefix = "+"
+		prefix = line.Prefix()
 		if r.useColor {
 			highlighted := r.highlightWithBg(language, line.Content, r.theme.added)
 			fmt.Fprintf(r.out, "%s%s%s%s%s%s%s\n",
@@ -214,7 +291,7 @@ func (r *Renderer) renderLine(language string, line *diff.Line) {
 			fmt.Fprintf(r.out, "%s%s%s\n", lineNumStr, prefix, line.Content)
 		}
 	case diff.LineRemoved:
-		prefix = "-"
+		prefix = line.Prefix()
 		if r.useColor {
 			highlighted := r.highlightWithBg(language, line.Content, r.theme.removed)
 			fmt.Fprintf(r.out, "%s%s%s%s%s%s%s\n",
@@ -224,7 +301,7 @@ func (r *Renderer) renderLine(language string, line *diff.Line) {
 			fmt.Fprintf(r.out, "%s%s%s\n", lineNumStr, prefix, line.Content)
 		}
 	case diff.LineContext:
-		prefix = " "
+		prefix = line.Prefix()
 		if r.useColor {
 			highlighted := r.highlightContent(language, line.Content)
 			fmt.Fprintf(r.out, "%s%s%s%s%s\n",
@@ -288,32 +365,52 @@ func (r *Renderer) writeDivider() {
 
 func (r *Renderer) RenderRaw(groups []grouper.SemanticGroup) error {
 	for i, group := range groups {
-		if i > 0 {
-			fmt.Fprintln(r.out, "---")
-			fmt.Fprintln(r.out)
-		}
-		fmt.Fprintf(r.out, "# %s\n\n", group.Title)
-		fmt.Fprintf(r.out, "%s\n\n", group.Description)
-		for _, gh := range group.Hunks {
-			fmt.Fprintf(r.out, "diff --git a/%s b/%s\n", gh.File.OldPath, gh.File.NewPath)
-			fmt.Fprintf(r.out, "@@ -%d,%d +%d,%d @@",
-				gh.Hunk.OldStart, gh.Hunk.OldCount,
-				gh.Hunk.NewStart, gh.Hunk.NewCount)
-			if gh.Hunk.Header != "" {
-				fmt.Fprintf(r.out, " %s", gh.Hunk.Header)
-			}
-			fmt.Fprintln(r.out)
-			for _, line := range gh.Hunk.Lines {
-				switch line.Type {
-				case diff.LineAdded:
-					fmt.Fprintf(r.out, "+%s\n", line.Content)
-				case diff.LineRemoved:
-					fmt.Fprintf(r.out, "-%s\n", line.Content)
-				case diff.LineContext:
-					fmt.Fprintf(r.out, " %s\n", line.Content)
-				}
-			}
+		if err := r.RenderRawGroup(i, group); err != nil {
+			return err
 		}
 	}
 	return nil
 }
+
+func (r *Renderer) RenderRawGroup(index int, group grouper.SemanticGroup) error {
+	if index > 0 {
+		fmt.Fprintln(r.out, "---")
+		fmt.Fprintln(r.out)
+	}
+	r.renderRawNested(&group, 1)
+	return nil
+}
+
+func (r *Renderer) renderRawNested(group *grouper.SemanticGroup, level int) {
+	fmt.Fprintf(r.out, "%s %s\n\n", strings.Repeat("#", level), group.Title)
+	fmt.Fprintf(r.out, "%s\n\n", group.Description)
+	if group.Confidence > 0 {
+		fmt.Fprintf(r.out, "confidence: %.2f\n", group.Confidence)
+	}
+	for _, c := range group.Concerns {
+		fmt.Fprintf(r.out, "concern: %s\n", c)
+	}
+	if group.Confidence > 0 || len(group.Concerns) > 0 {
+		fmt.Fprintln(r.out)
+	}
+	if len(group.BuildsOn) > 0 {
+		fmt.Fprintf(r.out, "builds on: %s\n\n", strings.Join(group.BuildsOn, ", "))
+	}
+	if len(group.Children) > 0 {
+		for i := range group.Children {
+			r.renderRawNested(&group.Children[i], level+1)
+		}
+		return
+	}
+	for _, gh := range group.Stitched() {
+		fmt.Fprint(r.out, gh.File.DiffHeader())
+		fmt.Fprint(r.out, gh.Hunk.Range())
+		if gh.Hunk.Header != "" {
+			fmt.Fprintf(r.out, " %s", gh.Hunk.Header)
+		}
+		fmt.Fprintln(r.out)
+		for _, line := range gh.Hunk.Lines {
+			fmt.Fprintf(r.out, "%s%s\n", line.Prefix(), line.Content)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package scope
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"regexp"
+	"strings"
+)
+
+// Block is a declaration that encloses a range of lines, numbered from 1.
+type Block struct {
+	Name  string
+	Start int
+	End   int
+}
+
+const (
+	maxScanUp   = 300
+	maxBlockLen = 400
+)
+
+// Find returns the function or type in src that encloses lines start to
+// end. Go files are parsed; other languages are matched by declaration
+// keywords, braces and indentation.
+func Find(path string, src []byte, start, end int) (Block, bool) {
+	if strings.HasSuffix(path, ".go") {
+		if b, ok, err := findGo(src, start, end); err == nil {
+			return b, ok
+		}
+	}
+	return findByIndent(strings.Split(string(src), "\n"), start, end)
+}
+
+func findGo(src []byte, start, end int) (Block, bool, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", src, parser.ParseComments|parser.SkipObjectResolution)
+	if err != nil {
+		return Block{}, false, err
+	}
+
+	for _, decl := range file.Decls {
+		from, to := decl.Pos(), decl.End()
+		var name string
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			if d.Doc != nil {
+				from = d.Doc.Pos()
+			}
+			name = "func " + funcName(d)
+		case *ast.GenDecl:
+			if d.Tok == token.IMPORT {
+				continue
+			}
+			if d.Doc != nil {
+				from = d.Doc.Pos()
+			}
+			name = genDeclName(d)
+		}
+
+		b := Block{Name: name, Start: fset.Position(from).Line, End: fset.Position(to).Line}
+		if b.Start <= start && end <= b.End {
+			return b, true, nil
+		}
+	}
+	return Block{}, false, nil
+}
+
+func funcName(d *ast.FuncDecl) string {
+	if d.Recv == nil || len(d.Recv.List) == 0 {
+		return d.Name.Name
+	}
+	recv := d.Recv.List[0].Type
+	if star, ok := recv.(*ast.StarExpr); ok {
+		recv = star.X
+	}
+	if index, ok := recv.(*ast.IndexExpr); ok {
+		recv = index.X
+	}
+	if index, ok := recv.(*ast.IndexListExpr); ok {
+		recv = index.X
+	}
+	if ident, ok := recv.(*ast.Ident); ok {
+		return ident.Name + "." + d.Name.Name
+	}
+	return d.Name.Name
+}
+
+func genDeclName(d *ast.GenDecl) string {
+	if len(d.Specs) == 1 {
+		switch s := d.Specs[0].(type) {
+		case *ast.TypeSpec:
+			return "type " + s.Name.Name
+		case *ast.ValueSpec:
+			if len(s.Names) > 0 {
+				return d.Tok.String() + " " + s.Names[0].Name
+			}
+		}
+	}
+	return d.Tok.String() + " block"
+}
+
+var declRe = regexp.MustCompile(`^\s*(?:(?:export|default|pub(?:\([a-z]+\))?|public|private|protected|internal|static|async|abstract|final|override|inline|unsafe|extern)\s+)*(?:def|class|func|function|fn|impl|struct|enum|interface|trait|module|object|type|sub|proc)\b`)
+
+func findByIndent(lines []string, start, end int) (Block, bool) {
+	if start < 1 || start > len(lines) {
+		return Block{}, false
+	}
+
+	limit := indentOf(lines, start)
+	for i := start; i >= max(1, start-maxScanUp); i-- {
+		line := lines[i-1]
+		if strings.TrimSpace(line) == "" || !declRe.MatchString(line) {
+			continue
+		}
+		indent := leadingSpace(line)
+		if i != start && indent > limit {
+			continue
+		}
+
+		blockEnd := blockEnd(lines, i)
+		if blockEnd >= end {
+			return Block{Name: strings.TrimRight(strings.TrimSpace(line), " {:"), Start: i, End: blockEnd}, true
+		}
+		// This declaration ends before the change does; look further out.
+		limit = indent - 1
+		if limit < 0 {
+			break
+		}
+	}
+	return Block{}, false
+}
+
+// blockEnd finds the last line of the declaration starting at line i: the
+// line closing its braces, or for indentation-based languages the last line
+// indented deeper than the declaration.
+func blockEnd(lines []string, i int) int {
+	last := min(len(lines), i+maxBlockLen)
+	if strings.Contains(lines[i-1], "{") || (i < len(lines) && strings.TrimSpace(lines[i]) == "{") {
+		depth := 0
+		opened := false
+		for j := i; j <= last; j++ {
+			for _, r := range lines[j-1] {
+				switch r {
+				case '{':
+					depth++
+					opened = true
+				case '}':
+					depth--
+				}
+			}
+			if opened && depth <= 0 {
+				return j
+			}
+		}
+		return last
+	}
+
+	indent := leadingSpace(lines[i-1])
+	end := i
+	for j := i + 1; j <= last; j++ {
+		if strings.TrimSpace(lines[j-1]) == "" {
+			continue
+		}
+		if leadingSpace(lines[j-1]) <= indent {
+			break
+		}
+		end = j
+	}
+	return end
+}
+
+func indentOf(lines []string, n int) int {
+	for i := n; i <= len(lines); i++ {
+		if strings.TrimSpace(lines[i-1]) != "" {
+			return leadingSpace(lines[i-1])
+		}
+	}
+	return 0
+}
+
+func leadingSpace(line string) int {
+	n := 0
+	for _, r := range line {
+		switch r {
+		case ' ':
+			n++
+		case '\t':
+			n += 4
+		default:
+			return n
+		}
+	}
+	return n
+}
+
+// Render prints lines Start to End of b with their line numbers. Lines in
+// changed are marked with ">", all others are unchanged context.
+func Render(src []byte, b Block, changed map[int]bool) string {
+	lines := strings.Split(string(src), "\n")
+	var sb strings.Builder
+	for n := b.Start; n <= b.End && n <= len(lines); n++ {
+		marker := " "
+		if changed[n] {
+			marker = ">"
+		}
+		fmt.Fprintf(&sb, "%s %5d  %s\n", marker, n, lines[n-1])
+	}
+	return sb.String()
+}
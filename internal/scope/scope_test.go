@@ -0,0 +1,98 @@
+package scope
+
+import (
+	"reflect"
+	"testing"
+)
+
+const goSrc = `package shapes
+
+import "fmt"
+
+// Area returns the area of a rectangle.
+// It panics on negative sides.
+func Area(w, h int) int {
+	if w < 0 || h < 0 {
+		panic(fmt.Sprint(w, h))
+	}
+	return w * h
+}
+
+type Stack[T any] struct {
+	items []T
+}
+
+func (s *Stack[T]) Push(v T) {
+	s.items = append(s.items, v)
+}
+
+var (
+	zero = 0
+	one  = 1
+)
+`
+
+const pySrc = `class Shape:
+    def __init__(self, name):
+        self.name = name
+
+    def area(self):
+        return 0
+
+def main():
+    print(Shape("x").area())
+`
+
+const jsSrc = `export function add(a, b) {
+  return a + b;
+}
+
+function sub(a, b) {
+  return a - b;
+}
+`
+
+func TestFind(t *testing.T) {
+	tests := []struct {
+		name       string
+		path, src  string
+		start, end int
+		want       Block
+		wantOK     bool
+	}{
+		{name: "func with doc comment", path: "area.go", src: goSrc, start: 8, end: 10, want: Block{Name: "func Area", Start: 5, End: 12}, wantOK: true},
+		{name: "doc comment line", path: "area.go", src: goSrc, start: 6, end: 6, want: Block{Name: "func Area", Start: 5, End: 12}, wantOK: true},
+		{name: "generic method", path: "area.go", src: goSrc, start: 19, end: 19, want: Block{Name: "func Stack.Push", Start: 18, End: 20}, wantOK: true},
+		{name: "type", path: "area.go", src: goSrc, start: 15, end: 15, want: Block{Name: "type Stack", Start: 14, End: 16}, wantOK: true},
+		{name: "var block", path: "area.go", src: goSrc, start: 24, end: 24, want: Block{Name: "var block", Start: 22, End: 25}, wantOK: true},
+		{name: "import", path: "area.go", src: goSrc, start: 3, end: 3},
+		{name: "between decls", path: "area.go", src: goSrc, start: 13, end: 13},
+		{name: "spans two decls", path: "area.go", src: goSrc, start: 11, end: 15},
+		{name: "invalid Go falls back", path: "broken.go", src: "package p\n\nfunc f() {\n\tx :=\n}\n", start: 4, end: 4, want: Block{Name: "func f()", Start: 3, End: 5}, wantOK: true},
+		{name: "python method", path: "shape.py", src: pySrc, start: 6, end: 6, want: Block{Name: "def area(self)", Start: 5, End: 6}, wantOK: true},
+		{name: "python class", path: "shape.py", src: pySrc, start: 3, end: 5, want: Block{Name: "class Shape", Start: 1, End: 6}, wantOK: true},
+		{name: "python top level", path: "shape.py", src: pySrc, start: 9, end: 9, want: Block{Name: "def main()", Start: 8, End: 9}, wantOK: true},
+		{name: "js braces", path: "math.js", src: jsSrc, start: 2, end: 2, want: Block{Name: "export function add(a, b)", Start: 1, End: 3}, wantOK: true},
+		{name: "js between functions", path: "math.js", src: jsSrc, start: 4, end: 4},
+		{name: "out of range", path: "math.js", src: jsSrc, start: 40, end: 40},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := Find(tt.path, []byte(tt.src), tt.start, tt.end)
+			if ok != tt.wantOK || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Find(%d, %d) = %+v, %v, want %+v, %v", tt.start, tt.end, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestRender(t *testing.T) {
+	got := Render([]byte(jsSrc), Block{Start: 1, End: 3}, map[int]bool{2: true})
+	want := "      1  export function add(a, b) {\n" +
+		">     2    return a + b;\n" +
+		"      3  }\n"
+	if got != want {
+		t.Errorf("Render =\n%s\nwant\n%s", got, want)
+	}
+}
@@ -10,16 +10,40 @@ import (
 type Spinner struct {
 	out     io.Writer
 	message string
+	width   int
 	frames  []string
 	stop    chan struct{}
 	done    chan struct{}
 	mu      sync.Mutex
+	started bool
+	once    sync.Once
+}
+
+var (
+	activeMu sync.Mutex
+	active   = make(map[*Spinner]bool)
+)
+
+// StopAll stops every running spinner and clears its line, for when the
+// process is about to exit without unwinding.
+func StopAll() {
+	activeMu.Lock()
+	spinners := make([]*Spinner, 0, len(active))
+	for s := range active {
+		spinners = append(spinners, s)
+	}
+	activeMu.Unlock()
+
+	for _, s := range spinners {
+		s.Stop()
+	}
 }
 
 func New(out io.Writer, message string) *Spinner {
 	return &Spinner{
 		out:     out,
 		message: message,
+		width:   len(message),
 		frames:  []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"},
 		stop:    make(chan struct{}),
 		done:    make(chan struct{}),
@@ -27,6 +51,10 @@ func New(out io.Writer, message string) *Spinner {
 }
 
 func (s *Spinner) Start() {
+	s.started = true
+	activeMu.Lock()
+	active[s] = true
+	activeMu.Unlock()
 	go func() {
 		defer close(s.done)
 		i := 0
@@ -37,7 +65,7 @@ func (s *Spinner) Start() {
 				return
 			default:
 				s.mu.Lock()
-				fmt.Fprintf(s.out, "\r%s %s", s.frames[i%len(s.frames)], s.message)
+				fmt.Fprintf(s.out, "\r%s %-*s", s.frames[i%len(s.frames)], s.width, s.message)
 				s.mu.Unlock()
 				i++
 				time.Sleep(80 * time.Millisecond)
@@ -47,12 +75,26 @@ func (s *Spinner) Start() {
 }
 
 func (s *Spinner) Stop() {
-	close(s.stop)
-	<-s.done
+	s.once.Do(func() {
+		close(s.stop)
+		if s.started {
+			<-s.done
+		}
+		activeMu.Lock()
+		delete(active, s)
+		activeMu.Unlock()
+	})
+}
+
+func (s *Spinner) SetMessage(message string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.message = message
+	s.width = max(s.width, len(message))
 }
 
 func (s *Spinner) clear() {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	fmt.Fprintf(s.out, "\r%*s\r", len(s.message)+3, "")
+	fmt.Fprintf(s.out, "\r%*s\r", s.width+3, "")
 }
@@ -1,6 +1,7 @@
 package tui
 
 import (
+	"context"
 	"fmt"
 	"strings"
 
@@ -9,6 +10,7 @@ import (
 	"github.com/alecthomas/chroma/v2/styles"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
+	"github.com/jm/hnk/internal/ai"
 	"github.com/jm/hnk/internal/diff"
 	"github.com/jm/hnk/internal/grouper"
 )
@@ -22,6 +24,7 @@ type theme struct {
 	lineNum   lipgloss.Style
 	hunk      lipgloss.Style
 	context   lipgloss.Style
+	warn      lipgloss.Style
 	addedBg   lipgloss.Color
 	removedBg lipgloss.Color
 	syntax    *chroma.Style
@@ -36,6 +39,7 @@ var darkTheme = theme{
 	lineNum:   lipgloss.NewStyle().Faint(true),
 	hunk:      lipgloss.NewStyle().Foreground(lipgloss.Color("magenta")),
 	context:   lipgloss.NewStyle(),
+	warn:      lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("214")),
 	addedBg:   lipgloss.Color("22"),
 	removedBg: lipgloss.Color("52"),
 }
@@ -49,25 +53,84 @@ var lightTheme = theme{
 	lineNum:   lipgloss.NewStyle().Foreground(lipgloss.Color("240")),
 	hunk:      lipgloss.NewStyle().Foreground(lipgloss.Color("magenta")),
 	context:   lipgloss.NewStyle(),
+	warn:      lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("130")),
 	addedBg:   lipgloss.Color("194"),
 	removedBg: lipgloss.Color("224"),
 }
 
 type Model struct {
+	commits      []grouper.Commit
+	commitIndex  int
 	groups       []grouper.SemanticGroup
 	groupIndex   int
+	path         []int
 	scrollOffset int
 	width        int
 	height       int
 	theme        theme
 	lineNums     bool
 	lines        []string
+	loading      bool
+	progress     string
+	// err is why the groups or commits stopped arriving.
+	err error
+
+	ask           AskFunc
+	conversations map[string]*conversation
+	asking        bool
+	input         []rune
+	answerFocus   bool
+	answerScroll  int
+	answerLines   []string
+	lastQuestion  int
 }
 
+type conversation struct {
+	history []ai.Exchange
+	pending string
+	err     error
+}
+
+type groupMsg struct {
+	group grouper.SemanticGroup
+}
+
+// commitMsg adds the next commit of a log.
+type commitMsg struct {
+	commit grouper.Commit
+}
+
+// resetMsg drops the groups received so far; the groups that replace
+// them follow.
+type resetMsg struct{}
+
+// doneMsg ends loading; err is set when the producer failed.
+type doneMsg struct {
+	err error
+}
+
+type progressMsg struct {
+	done  int
+	total int
+}
+
+type answerMsg struct {
+	group    string
+	question string
+	answer   string
+	err      error
+}
+
+type AskFunc func(group grouper.SemanticGroup, history []ai.Exchange, question string) (string, error)
+
 type Options struct {
 	LightMode   bool
 	LineNumbers bool
 	StyleName   string
+	Ask         AskFunc
+	// InputTTY reads keys from the terminal instead of stdin, for when
+	// stdin is the diff.
+	InputTTY bool
 }
 
 func New(groups []grouper.SemanticGroup, opts Options) Model {
@@ -86,11 +149,13 @@ func New(groups []grouper.SemanticGroup, opts Options) Model {
 	}
 
 	m := Model{
-		groups:   groups,
-		theme:    th,
-		lineNums: opts.LineNumbers,
-		width:    80,
-		height:   24,
+		groups:        groups,
+		theme:         th,
+		lineNums:      opts.LineNumbers,
+		width:         80,
+		height:        24,
+		ask:           opts.Ask,
+		conversations: make(map[string]*conversation),
 	}
 	m.rebuildLines()
 	return m
@@ -103,84 +168,339 @@ func (m Model) Init() tea.Cmd {
 func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
+		if m.asking {
+			return m.updateInput(msg)
+		}
 		switch msg.String() {
-		case "q", "ctrl+c", "esc":
+		case "q", "ctrl+c":
 			return m, tea.Quit
+		case "esc":
+			if len(m.path) == 0 {
+				return m, tea.Quit
+			}
+			m.drillOut()
+		case "backspace":
+			m.drillOut()
+		case "enter":
+			if len(m.groups) > 0 && len(m.current().Children) > 0 {
+				m.path = append(m.path, m.groupIndex)
+				m.selectGroup(0)
+			}
+		case "[":
+			if m.commitIndex > 0 {
+				m.selectCommit(m.commitIndex - 1)
+			}
+		case "]":
+			if m.commitIndex < len(m.commits)-1 {
+				m.selectCommit(m.commitIndex + 1)
+			}
 		case "left", "h":
 			if m.groupIndex > 0 {
-				m.groupIndex--
-				m.scrollOffset = 0
-				m.rebuildLines()
+				m.selectGroup(m.groupIndex - 1)
 			}
 		case "right", "l":
-			if m.groupIndex < len(m.groups)-1 {
-				m.groupIndex++
-				m.scrollOffset = 0
-				m.rebuildLines()
+			if m.groupIndex < len(m.level())-1 {
+				m.selectGroup(m.groupIndex + 1)
 			}
-		case "up", "k":
-			if m.scrollOffset > 0 {
-				m.scrollOffset--
+		case "a":
+			if m.ask != nil && len(m.groups) > 0 {
+				m.asking = true
+				m.input = nil
 			}
+		case "tab":
+			m.answerFocus = !m.answerFocus && m.showAnswers()
+		case "up", "k":
+			m.scrollTo(m.scrollPos() - 1)
 		case "down", "j":
-			maxScroll := len(m.lines) - m.contentHeight()
-			if maxScroll < 0 {
-				maxScroll = 0
-			}
-			if m.scrollOffset < maxScroll {
-				m.scrollOffset++
-			}
+			m.scrollTo(m.scrollPos() + 1)
 		case " ", "pgdown":
-			maxScroll := len(m.lines) - m.contentHeight()
-			if maxScroll < 0 {
-				maxScroll = 0
-			}
-			m.scrollOffset += m.contentHeight()
-			if m.scrollOffset > maxScroll {
-				m.scrollOffset = maxScroll
-			}
+			m.scrollTo(m.scrollPos() + m.pageHeight())
 		case "pgup":
-			m.scrollOffset -= m.contentHeight()
-			if m.scrollOffset < 0 {
-				m.scrollOffset = 0
-			}
+			m.scrollTo(m.scrollPos() - m.pageHeight())
 		case "g":
-			m.scrollOffset = 0
+			m.scrollTo(0)
 		case "G":
-			maxScroll := len(m.lines) - m.contentHeight()
-			if maxScroll < 0 {
-				maxScroll = 0
-			}
-			m.scrollOffset = maxScroll
+			m.scrollTo(len(m.lines) + len(m.answerLines))
 		}
 	case tea.WindowSizeMsg:
 		m.width = msg.Width
 		m.height = msg.Height
+		m.rebuildAnswerLines()
+	case groupMsg:
+		m.groups = append(m.groups, msg.group)
+		if len(m.groups) == 1 {
+			m.rebuildLines()
+		}
+	case commitMsg:
+		m.commits = append(m.commits, msg.commit)
+		if len(m.commits) == 1 {
+			m.selectCommit(0)
+		}
+	case resetMsg:
+		m.groups = nil
+		m.groupIndex = 0
+		m.path = nil
+		m.scrollOffset = 0
+		m.conversations = make(map[string]*conversation)
+		m.answerFocus = false
+		m.asking = false
+		m.input = nil
+		m.rebuildLines()
+		m.rebuildAnswerLines()
+	case progressMsg:
+		m.progress = fmt.Sprintf("%d/%d batches", msg.done, msg.total)
+		if len(m.groups) == 0 {
+			m.rebuildLines()
+		}
+	case doneMsg:
+		m.loading = false
+		m.progress = ""
+		m.err = msg.err
+		if len(m.groups) == 0 {
+			m.rebuildLines()
+		}
+	case answerMsg:
+		conv := m.conversation(msg.group)
+		conv.pending = ""
+		conv.err = msg.err
+		if msg.err == nil {
+			conv.history = append(conv.history, ai.Exchange{Question: msg.question, Answer: msg.answer})
+		}
+		if msg.group == m.conversationKey() {
+			m.rebuildAnswerLines()
+			m.answerScroll = m.lastQuestion
+			m.clampScroll()
+		}
+	}
+	return m, nil
+}
+
+func (m Model) updateInput(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.Type {
+	case tea.KeyEsc, tea.KeyCtrlC:
+		m.asking = false
+		m.input = nil
+	case tea.KeyEnter:
+		question := strings.TrimSpace(string(m.input))
+		m.asking = false
+		m.input = nil
+		if question == "" {
+			return m, nil
+		}
+		return m, m.sendQuestion(question)
+	case tea.KeyBackspace:
+		if len(m.input) > 0 {
+			m.input = m.input[:len(m.input)-1]
+		}
+	case tea.KeySpace:
+		m.input = append(m.input, ' ')
+	case tea.KeyRunes:
+		m.input = append(m.input, msg.Runes...)
 	}
 	return m, nil
 }
 
+func (m *Model) sendQuestion(question string) tea.Cmd {
+	if len(m.groups) == 0 {
+		return nil
+	}
+	key := m.conversationKey()
+	conv := m.conversation(key)
+	if conv.pending != "" {
+		return nil
+	}
+	conv.pending = question
+	conv.err = nil
+	m.rebuildAnswerLines()
+	m.answerScroll = m.lastQuestion
+	m.clampScroll()
+
+	group := *m.current()
+	history := append([]ai.Exchange(nil), conv.history...)
+	ask := m.ask
+	return func() tea.Msg {
+		answer, err := ask(group, history, question)
+		return answerMsg{group: key, question: question, answer: answer, err: err}
+	}
+}
+
+func (m *Model) conversation(key string) *conversation {
+	conv, ok := m.conversations[key]
+	if !ok {
+		conv = &conversation{}
+		m.conversations[key] = conv
+	}
+	return conv
+}
+
+func (m *Model) conversationKey() string {
+	return fmt.Sprint(m.commitIndex, append(append([]int(nil), m.path...), m.groupIndex))
+}
+
+func (m *Model) level() []grouper.SemanticGroup {
+	groups := m.groups
+	for _, i := range m.path {
+		groups = groups[i].Children
+	}
+	return groups
+}
+
+func (m *Model) current() *grouper.SemanticGroup {
+	return &m.level()[m.groupIndex]
+}
+
+func (m *Model) drillOut() {
+	if len(m.path) == 0 {
+		return
+	}
+	parent := m.path[len(m.path)-1]
+	m.path = m.path[:len(m.path)-1]
+	m.selectGroup(parent)
+}
+
+func (m *Model) breadcrumb() string {
+	var parts []string
+	groups := m.groups
+	for _, i := range m.path {
+		parts = append(parts, groups[i].Title)
+		groups = groups[i].Children
+	}
+	return strings.Join(parts, " › ")
+}
+
+func (m *Model) selectCommit(index int) {
+	m.commitIndex = index
+	m.groups = m.commits[index].Groups
+	m.path = nil
+	m.selectGroup(0)
+}
+
+func (m *Model) commitHeader() []string {
+	if len(m.commits) == 0 {
+		return nil
+	}
+	c := m.commits[m.commitIndex]
+	return []string{
+		m.theme.hunk.Render(c.Ref(m.commitIndex)) + " " + m.theme.title.Render(c.Subject) + " " + m.theme.desc.Render(c.Author+", "+c.Date),
+		m.theme.lineNum.Render(strings.Repeat("━", 80)),
+	}
+}
+
+func (m *Model) selectGroup(index int) {
+	m.groupIndex = index
+	m.scrollOffset = 0
+	m.rebuildLines()
+	m.rebuildAnswerLines()
+	m.answerScroll = m.lastQuestion
+	m.answerFocus = m.answerFocus && m.showAnswers()
+	m.clampScroll()
+}
+
+func (m *Model) showAnswers() bool {
+	conv, ok := m.conversations[m.conversationKey()]
+	return ok && (len(conv.history) > 0 || conv.pending != "" || conv.err != nil)
+}
+
+func (m *Model) scrollPos() int {
+	if m.answerFocus {
+		return m.answerScroll
+	}
+	return m.scrollOffset
+}
+
+func (m *Model) pageHeight() int {
+	if m.answerFocus {
+		return m.answerHeight()
+	}
+	return m.contentHeight()
+}
+
+func (m *Model) scrollTo(offset int) {
+	if m.answerFocus {
+		m.answerScroll = offset
+	} else {
+		m.scrollOffset = offset
+	}
+	m.clampScroll()
+}
+
+func (m *Model) clampScroll() {
+	m.scrollOffset = clamp(m.scrollOffset, len(m.lines)-m.contentHeight())
+	m.answerScroll = clamp(m.answerScroll, len(m.answerLines)-m.answerHeight())
+}
+
+func clamp(offset, maxOffset int) int {
+	return max(0, min(offset, maxOffset))
+}
+
+func (m *Model) answerHeight() int {
+	if !m.showAnswers() {
+		return 0
+	}
+	return max(m.height/3, 3)
+}
+
 func (m *Model) contentHeight() int {
-	if m.height < 2 {
-		return 1
+	h := m.height - 1
+	if m.asking {
+		h--
+	}
+	if m.showAnswers() {
+		h -= m.answerHeight() + 1
 	}
-	return m.height - 1
+	return max(h, 1)
+}
+
+func (m *Model) badges(group *grouper.SemanticGroup) string {
+	style := m.theme.desc
+	if group.NeedsAttention() {
+		style = m.theme.warn
+	}
+	var s string
+	for _, b := range group.Badges() {
+		s += " " + style.Render("["+b+"]")
+	}
+	return s
 }
 
 func (m *Model) rebuildLines() {
 	if len(m.groups) == 0 {
-		m.lines = []string{"No changes to display"}
+		if m.loading {
+			m.lines = []string{m.loadingMessage()}
+		} else {
+			m.lines = append(m.commitHeader(), m.emptyMessage())
+		}
 		return
 	}
 
-	group := m.groups[m.groupIndex]
-	var lines []string
+	group := m.current()
+	lines := m.commitHeader()
 
-	lines = append(lines, m.theme.title.Render(group.Title))
+	lines = append(lines, m.theme.title.Render(group.Title)+m.badges(group))
 	lines = append(lines, m.theme.desc.Render(group.Description))
+	for _, c := range group.Concerns {
+		lines = append(lines, m.theme.warn.Render("! "+c))
+	}
+	if len(group.BuildsOn) > 0 {
+		lines = append(lines, m.theme.hunk.Render("builds on: "+strings.Join(group.BuildsOn, ", ")))
+	}
 	lines = append(lines, "")
 
-	for _, gh := range group.Hunks {
+	if len(group.Children) > 0 {
+		for i, child := range group.Children {
+			lines = append(lines, m.theme.title.Render(fmt.Sprintf("  %d. %s", i+1, child.Title))+m.badges(&child))
+			if child.Description != "" {
+				lines = append(lines, m.theme.desc.Render("     "+child.Description))
+			}
+			lines = append(lines, m.theme.lineNum.Render("     "+childSummary(&child)))
+			lines = append(lines, "")
+		}
+		lines = append(lines, m.theme.desc.Render("Press enter to open this theme"))
+		m.lines = lines
+		return
+	}
+
+	for _, gh := range group.Stitched() {
 		lines = append(lines, m.fileHeader(gh.File))
 		lines = append(lines, m.hunkLines(gh.File, gh.Hunk)...)
 		lines = append(lines, "")
@@ -189,6 +509,46 @@ func (m *Model) rebuildLines() {
 	m.lines = lines
 }
 
+func (m *Model) rebuildAnswerLines() {
+	m.answerLines = nil
+	m.lastQuestion = 0
+	conv, ok := m.conversations[m.conversationKey()]
+	if !ok {
+		return
+	}
+
+	wrap := lipgloss.NewStyle().Width(max(m.width, 20))
+	addQuestion := func(q string) {
+		if len(m.answerLines) > 0 {
+			m.answerLines = append(m.answerLines, "")
+		}
+		m.lastQuestion = len(m.answerLines)
+		m.answerLines = append(m.answerLines, strings.Split(wrap.Inherit(m.theme.title).Render("Q: "+q), "\n")...)
+	}
+
+	for _, ex := range conv.history {
+		addQuestion(ex.Question)
+		m.answerLines = append(m.answerLines, strings.Split(wrap.Render(ex.Answer), "\n")...)
+	}
+	switch {
+	case conv.pending != "":
+		addQuestion(conv.pending)
+		m.answerLines = append(m.answerLines, m.theme.desc.Render("Thinking..."))
+	case conv.err != nil:
+		m.answerLines = append(m.answerLines, "")
+		m.answerLines = append(m.answerLines, strings.Split(wrap.Inherit(m.theme.desc).Render("Could not get an answer: "+conv.err.Error()), "\n")...)
+	}
+}
+
+func childSummary(g *grouper.SemanticGroup) string {
+	files := make(map[*diff.FileDiff]bool)
+	hunks := g.AllHunks()
+	for _, gh := range hunks {
+		files[gh.File] = true
+	}
+	return grouper.Plural(len(hunks), "hunk") + " in " + grouper.Plural(len(files), "file")
+}
+
 func (m *Model) fileHeader(f *diff.FileDiff) string {
 	var label string
 	switch {
@@ -207,10 +567,13 @@ func (m *Model) fileHeader(f *diff.FileDiff) string {
 func (m *Model) hunkLines(f *diff.FileDiff, h *diff.Hunk) []string {
 	var lines []string
 
-	header := fmt.Sprintf("@@ -%d,%d +%d,%d @@", h.OldStart, h.OldCount, h.NewStart, h.NewCount)
+	header := h.Range()
 	if h.Header != "" {
 		header += " " + h.Header
 	}
+	if stage := h.Stage(); stage != 0 {
+		header += " [" + stage.String() + "]"
+	}
 	lines = append(lines, m.theme.hunk.Render(header))
 
 	for _, line := range h.Lines {
@@ -239,13 +602,13 @@ func (m *Model) renderLine(language string, line *diff.Line) string {
 	switch line.Type {
 	case diff.LineAdded:
 		highlighted := m.highlightLine(language, line.Content, m.theme.addedBg)
-		return numPart + m.theme.added.Render("+") + highlighted
+		return numPart + m.theme.added.Render(line.Prefix()) + highlighted
 	case diff.LineRemoved:
 		highlighted := m.highlightLine(language, line.Content, m.theme.removedBg)
-		return numPart + m.theme.removed.Render("-") + highlighted
+		return numPart + m.theme.removed.Render(line.Prefix()) + highlighted
 	case diff.LineContext:
 		highlighted := m.highlightLine(language, line.Content, "")
-		return numPart + " " + highlighted
+		return numPart + line.Prefix() + highlighted
 	}
 	return ""
 }
@@ -296,8 +659,11 @@ func (m *Model) highlightLine(language, content string, bg lipgloss.Color) strin
 }
 
 func (m Model) View() string {
-	if len(m.groups) == 0 {
-		return "No changes to display"
+	if len(m.groups) == 0 && len(m.commits) == 0 {
+		if m.loading {
+			return m.loadingMessage()
+		}
+		return m.emptyMessage()
 	}
 
 	var b strings.Builder
@@ -323,6 +689,31 @@ func (m Model) View() string {
 		Foreground(lipgloss.Color("252")).
 		Padding(0, 1)
 
+	if m.showAnswers() {
+		label := "Answers (tab: focus)"
+		if m.answerFocus {
+			label = "Answers (tab: back to diff)"
+		}
+		b.WriteString(m.theme.desc.Render("── " + label + " " + strings.Repeat("─", max(m.width-len(label)-4, 0))))
+		b.WriteString("\n")
+
+		answerHeight := m.answerHeight()
+		end := min(m.answerScroll+answerHeight, len(m.answerLines))
+		visible := m.answerLines[m.answerScroll:end]
+		for _, line := range visible {
+			b.WriteString(line)
+			b.WriteString("\n")
+		}
+		for i := len(visible); i < answerHeight; i++ {
+			b.WriteString("\n")
+		}
+	}
+
+	if m.asking {
+		b.WriteString(m.theme.title.Render("Ask: ") + string(m.input) + "█")
+		b.WriteString("\n")
+	}
+
 	progress := ""
 	if len(m.lines) > contentHeight {
 		pct := 0
@@ -333,8 +724,45 @@ func (m Model) View() string {
 		progress = fmt.Sprintf(" %d%%", pct)
 	}
 
-	status := fmt.Sprintf("Group %d/%d%s │ ←/→: groups │ j/k: scroll │ space: page │ q: quit",
-		m.groupIndex+1, len(m.groups), progress)
+	total := fmt.Sprintf("%d", len(m.level()))
+	if m.loading && len(m.path) == 0 && len(m.commits) == 0 {
+		total += "+"
+	}
+
+	keys := "←/→: groups │ j/k: scroll │ space: page │ q: quit"
+	switch {
+	case m.asking:
+		keys = "enter: ask │ esc: cancel"
+	case m.ask != nil:
+		keys = "←/→: groups │ j/k: scroll │ space: page │ a: ask │ q: quit"
+	}
+	switch {
+	case m.asking:
+	case len(m.groups) > 0 && len(m.current().Children) > 0:
+		keys = "enter: open │ " + keys
+	case len(m.path) > 0:
+		keys = "backspace: back │ " + keys
+	}
+	if len(m.commits) > 0 && !m.asking {
+		keys = "[/]: commits │ " + keys
+	}
+	status := fmt.Sprintf("Group %d/%s%s │ %s", m.groupIndex+1, total, progress, keys)
+	if len(m.groups) == 0 {
+		status = keys
+	}
+	if crumb := m.breadcrumb(); crumb != "" {
+		status = crumb + " › " + status
+	}
+	if len(m.commits) > 0 {
+		commits := fmt.Sprintf("%d", len(m.commits))
+		if m.loading {
+			commits += "+"
+		}
+		status = fmt.Sprintf("Commit %d/%s %s › %s", m.commitIndex+1, commits, m.commits[m.commitIndex].Ref(m.commitIndex), status)
+	}
+	if m.err != nil {
+		status += " │ error: " + m.err.Error()
+	}
 	b.WriteString(statusStyle.Render(status))
 
 	return b.String()
@@ -343,8 +771,89 @@ func (m Model) View() string {
 func Run(groups []grouper.SemanticGroup, opts Options) error {
 	p := tea.NewProgram(
 		New(groups, opts),
-		tea.WithAltScreen(),
+		programOptions(opts)...,
 	)
 	_, err := p.Run()
 	return err
 }
+
+// RunLog shows the commits of a log one at a time, each with its own
+// groups. It opens right away; produce passes the commits on in order as
+// they are analyzed.
+func RunLog(ctx context.Context, opts Options, produce func(ctx context.Context, emit func(grouper.Commit)) error) error {
+	return runProducer(ctx, opts, func(ctx context.Context, p *tea.Program) error {
+		return produce(ctx, func(c grouper.Commit) {
+			p.Send(commitMsg{commit: c})
+		})
+	})
+}
+
+func programOptions(opts Options, extra ...tea.ProgramOption) []tea.ProgramOption {
+	popts := append([]tea.ProgramOption{tea.WithAltScreen()}, extra...)
+	if opts.InputTTY {
+		popts = append(popts, tea.WithInputTTY())
+	}
+	return popts
+}
+
+func (m *Model) emptyMessage() string {
+	if m.err != nil && len(m.commits) == 0 {
+		return m.theme.warn.Render("Error: " + m.err.Error())
+	}
+	return "No changes to display"
+}
+
+func (m *Model) loadingMessage() string {
+	if m.progress != "" {
+		return "Analyzing changes (" + m.progress + ")..."
+	}
+	return "Analyzing changes..."
+}
+
+func RunStream(ctx context.Context, opts Options, produce func(ctx context.Context, emit func(grouper.SemanticGroup), reset func(), progress func(done, total int)) error) error {
+	return runProducer(ctx, opts, func(ctx context.Context, p *tea.Program) error {
+		return produce(ctx, func(group grouper.SemanticGroup) {
+			p.Send(groupMsg{group: group})
+		}, func() {
+			p.Send(resetMsg{})
+		}, func(done, total int) {
+			p.Send(progressMsg{done: done, total: total})
+		})
+	})
+}
+
+// runProducer opens the viewer while produce sends it what to show. If
+// produce fails, the viewer shows the error, and it is returned once the
+// viewer is closed.
+func runProducer(ctx context.Context, opts Options, produce func(ctx context.Context, p *tea.Program) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	m := New(nil, opts)
+	m.loading = true
+	m.rebuildLines()
+
+	p := tea.NewProgram(m, programOptions(opts, tea.WithContext(ctx))...)
+
+	errc := make(chan error, 1)
+	go func() {
+		err := produce(ctx, p)
+		errc <- err
+		if ctx.Err() != nil {
+			err = nil
+		}
+		p.Send(doneMsg{err: err})
+	}()
+
+	if _, err := p.Run(); err != nil {
+		return err
+	}
+
+	cancel()
+	select {
+	case err := <-errc:
+		return err
+	default:
+		return nil
+	}
+}
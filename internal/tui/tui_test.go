@@ -0,0 +1,93 @@
+package tui
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/jm/hnk/internal/ai"
+	"github.com/jm/hnk/internal/git"
+	"github.com/jm/hnk/internal/grouper"
+)
+
+// update feeds msgs to m in order.
+func update(m Model, msgs ...tea.Msg) Model {
+	for _, msg := range msgs {
+		next, _ := m.Update(msg)
+		m = next.(Model)
+	}
+	return m
+}
+
+func loading() Model {
+	m := New(nil, Options{})
+	m.loading = true
+	m.rebuildLines()
+	return update(m, tea.WindowSizeMsg{Width: 200, Height: 20})
+}
+
+func TestProducerError(t *testing.T) {
+	failed := errors.New("git log: bad revision")
+	commit := grouper.Commit{Commit: git.Commit{SHA: "0123456789abcdef", Subject: "Fix it"}}
+
+	tests := []struct {
+		name string
+		msgs []tea.Msg
+		want []string
+	}{
+		{
+			name: "nothing arrived",
+			msgs: []tea.Msg{doneMsg{}},
+			want: []string{"No changes to display"},
+		},
+		{
+			name: "failed before anything arrived",
+			msgs: []tea.Msg{doneMsg{err: failed}},
+			want: []string{"Error: git log: bad revision"},
+		},
+		{
+			name: "failed after a commit",
+			msgs: []tea.Msg{commitMsg{commit: commit}, doneMsg{err: failed}},
+			want: []string{"Fix it", "No changes to display", "error: git log: bad revision"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			view := update(loading(), tt.msgs...).View()
+			for _, want := range tt.want {
+				if !strings.Contains(view, want) {
+					t.Errorf("view does not show %q:\n%s", want, view)
+				}
+			}
+		})
+	}
+}
+
+func TestAskAcrossReset(t *testing.T) {
+	asked := false
+	m := New(nil, Options{Ask: func(grouper.SemanticGroup, []ai.Exchange, string) (string, error) {
+		asked = true
+		return "", nil
+	}})
+	m = update(m, tea.WindowSizeMsg{Width: 200, Height: 20}, groupMsg{group: grouper.SemanticGroup{Title: "First try"}})
+
+	key := func(s string) tea.KeyMsg { return tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(s)} }
+	m = update(m, key("a"), key("why"), resetMsg{})
+	if m.asking || len(m.input) > 0 {
+		t.Errorf("the ask input is still open after a reset: %q", string(m.input))
+	}
+
+	// Even with the input open and no groups, Enter must not ask about a
+	// group that is gone.
+	m.asking, m.input = true, []rune("why")
+	next, cmd := m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	if cmd != nil {
+		cmd()
+	}
+	if asked || next.(Model).asking {
+		t.Error("asked a question with no groups")
+	}
+}
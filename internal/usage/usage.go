@@ -0,0 +1,112 @@
+package usage
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+type Entry struct {
+	Time         time.Time `json:"time"`
+	Command      string    `json:"command,omitempty"`
+	Model        string    `json:"model"`
+	Calls        int       `json:"calls"`
+	InputTokens  int       `json:"input_tokens"`
+	OutputTokens int       `json:"output_tokens"`
+	CostUSD      float64   `json:"cost_usd"`
+}
+
+type Total struct {
+	Day          string
+	Model        string
+	Calls        int
+	InputTokens  int
+	OutputTokens int
+	CostUSD      float64
+}
+
+func LedgerPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".hnk", "usage.jsonl")
+}
+
+func Append(path string, e Entry) error {
+	if path == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func Load(path string) ([]Entry, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
+
+func Summarize(entries []Entry) []Total {
+	type key struct{ day, model string }
+	totals := make(map[key]*Total)
+	for _, e := range entries {
+		k := key{e.Time.Local().Format("2006-01-02"), e.Model}
+		t, ok := totals[k]
+		if !ok {
+			t = &Total{Day: k.day, Model: k.model}
+			totals[k] = t
+		}
+		t.Calls += e.Calls
+		t.InputTokens += e.InputTokens
+		t.OutputTokens += e.OutputTokens
+		t.CostUSD += e.CostUSD
+	}
+
+	result := make([]Total, 0, len(totals))
+	for _, t := range totals {
+		result = append(result, *t)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Day != result[j].Day {
+			return result[i].Day < result[j].Day
+		}
+		return result[i].Model < result[j].Model
+	})
+	return result
+}
@@ -0,0 +1,92 @@
+package usage
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSummarize(t *testing.T) {
+	day := func(d, hour int) time.Time {
+		return time.Date(2026, time.March, d, hour, 0, 0, 0, time.Local)
+	}
+
+	tests := []struct {
+		name    string
+		entries []Entry
+		want    []Total
+	}{
+		{name: "no entries", want: []Total{}},
+		{
+			name: "same day and model add up",
+			entries: []Entry{
+				{Time: day(2, 9), Model: "claude-sonnet-4-5", Calls: 1, InputTokens: 100, OutputTokens: 10, CostUSD: 0.5},
+				{Time: day(2, 23), Model: "claude-sonnet-4-5", Calls: 2, InputTokens: 200, OutputTokens: 20, CostUSD: 0.25},
+			},
+			want: []Total{
+				{Day: "2026-03-02", Model: "claude-sonnet-4-5", Calls: 3, InputTokens: 300, OutputTokens: 30, CostUSD: 0.75},
+			},
+		},
+		{
+			name: "split by day and model, sorted",
+			entries: []Entry{
+				{Time: day(3, 8), Model: "claude-sonnet-4-5", Calls: 1, InputTokens: 1, OutputTokens: 1, CostUSD: 1},
+				{Time: day(2, 8), Model: "claude-sonnet-4-5", Calls: 1, InputTokens: 2, OutputTokens: 2, CostUSD: 2},
+				{Time: day(2, 9), Model: "claude-haiku-4-5", Calls: 1, InputTokens: 4, OutputTokens: 4, CostUSD: 4},
+				{Time: day(3, 10), Model: "claude-sonnet-4-5", Calls: 1, InputTokens: 8, OutputTokens: 8, CostUSD: 8},
+			},
+			want: []Total{
+				{Day: "2026-03-02", Model: "claude-haiku-4-5", Calls: 1, InputTokens: 4, OutputTokens: 4, CostUSD: 4},
+				{Day: "2026-03-02", Model: "claude-sonnet-4-5", Calls: 1, InputTokens: 2, OutputTokens: 2, CostUSD: 2},
+				{Day: "2026-03-03", Model: "claude-sonnet-4-5", Calls: 2, InputTokens: 9, OutputTokens: 9, CostUSD: 9},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Summarize(tt.entries); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Summarize =\n%+v\nwant\n%+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAppendLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".hnk", "usage.jsonl")
+	if entries, err := Load(path); err != nil || entries != nil {
+		t.Fatalf("Load of a missing ledger = %v, %v", entries, err)
+	}
+
+	now := time.Date(2026, time.March, 2, 9, 0, 0, 0, time.UTC)
+	want := []Entry{
+		{Time: now, Command: "diff", Model: "claude-sonnet-4-5", Calls: 2, InputTokens: 300, OutputTokens: 30, CostUSD: 0.75},
+		{Time: now, Command: "log", Model: "claude-haiku-4-5", Calls: 1, InputTokens: 10, OutputTokens: 1, CostUSD: 0.01},
+	}
+	if err := Append(path, want[0]); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("{truncated\n")
+	f.Close()
+	if err := Append(path, want[1]); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Load =\n%+v\nwant\n%+v", got, want)
+	}
+
+	if err := Append(filepath.Join(path, "not-a-dir", "usage.jsonl"), want[0]); err == nil {
+		t.Error("Append into a file's path did not fail")
+	}
+}